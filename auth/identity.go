@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	cctx "github.com/budhip/common/context"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const spiffeScheme = "spiffe"
+
+// ServiceIdentity is the identity of a calling service taken from its verified client certificate
+type ServiceIdentity struct {
+	CommonName string   `json:"common_name,omitempty"`
+	SPIFFEID   string   `json:"spiffe_id,omitempty"`
+	URIs       []string `json:"uris,omitempty"`
+	DNSNames   []string `json:"dns_names,omitempty"`
+}
+
+// NewServiceIdentity returns identity of certificate, SPIFFEID is its first spiffe:// URI SAN
+func NewServiceIdentity(cert *x509.Certificate) ServiceIdentity {
+	identity := ServiceIdentity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+		if len(identity.SPIFFEID) == 0 && uri.Scheme == spiffeScheme {
+			identity.SPIFFEID = uri.String()
+		}
+	}
+	return identity
+}
+
+// Matches reports whether pattern matches the SPIFFE ID, a URI, a DNS name or the common name.
+// A pattern ending with * matches by prefix, e.g. spiffe://example.org/ns/payment/*
+func (i ServiceIdentity) Matches(pattern string) bool {
+	match := func(value string) bool {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			return strings.HasPrefix(value, prefix)
+		}
+		return value == pattern
+	}
+
+	for _, uri := range i.URIs {
+		if match(uri) {
+			return true
+		}
+	}
+	for _, name := range i.DNSNames {
+		if match(name) {
+			return true
+		}
+	}
+	return len(i.CommonName) > 0 && match(i.CommonName)
+}
+
+// PeerIdentity returns identity of the verified peer certificate of a TLS connection,
+// it is false when the peer sent no certificate or it was not verified
+func PeerIdentity(state tls.ConnectionState) (ServiceIdentity, bool) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ServiceIdentity{}, false
+	}
+	return NewServiceIdentity(state.VerifiedChains[0][0]), true
+}
+
+// WithServiceIdentity returns context carrying identity
+func WithServiceIdentity(ctx context.Context, identity ServiceIdentity) context.Context {
+	return context.WithValue(ctx, cctx.CtxServiceIdentity, identity)
+}
+
+// ServiceIdentityFromContext returns identity of the calling service
+func ServiceIdentityFromContext(ctx context.Context) (ServiceIdentity, bool) {
+	identity, ok := ctx.Value(cctx.CtxServiceIdentity).(ServiceIdentity)
+	return identity, ok
+}
+
+// WithPeerIdentityContext extracts identity of the gRPC peer verified by mutual TLS into context
+func WithPeerIdentityContext(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+	identity, ok := PeerIdentity(tlsInfo.State)
+	if !ok {
+		return ctx
+	}
+
+	return WithServiceIdentity(ctx, identity)
+}
+
+// WithPeerIdentityRequestContext extracts identity of the HTTP client verified by mutual TLS into request context
+func WithPeerIdentityRequestContext(req *http.Request) *http.Request {
+	if req.TLS == nil {
+		return req
+	}
+	identity, ok := PeerIdentity(*req.TLS)
+	if !ok {
+		return req
+	}
+
+	return req.WithContext(WithServiceIdentity(req.Context(), identity))
+}
+
+// IdentityPolicy lists the identity patterns allowed to call a method, see ServiceIdentity.Matches.
+// Keys are full gRPC methods such as /pkg.Service/Method or HTTP paths, "/pkg.Service/*" covers every
+// method of a service and "*" every method. Methods without entry are not restricted by identity.
+type IdentityPolicy map[string][]string
+
+func (p IdentityPolicy) patterns(method string) ([]string, bool) {
+	if patterns, ok := p[method]; ok {
+		return patterns, true
+	}
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		if patterns, ok := p[method[:i+1]+"*"]; ok {
+			return patterns, true
+		}
+	}
+	patterns, ok := p["*"]
+	return patterns, ok
+}
+
+// Restricted reports whether method may only be called by the identities of the policy
+func (p IdentityPolicy) Restricted(method string) bool {
+	_, ok := p.patterns(method)
+	return ok
+}
+
+// Allow reports whether identity in ctx may call method, unrestricted methods are always allowed
+func (p IdentityPolicy) Allow(ctx context.Context, method string) bool {
+	patterns, ok := p.patterns(method)
+	if !ok {
+		return true
+	}
+	identity, ok := ServiceIdentityFromContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, pattern := range patterns {
+		if identity.Matches(pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package breaker
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/budhip/common/metrics"
+)
+
+// State of circuit breaker
+type State int
+
+const (
+	// Closed lets every call through and records their outcome
+	Closed State = iota
+	// HalfOpen lets a few probe calls through to test whether the dependency recovered
+	HalfOpen
+	// Open fails every call fast until OpenTimeout elapsed
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+// ErrOpen is returned when the circuit breaker rejects a call
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Clock returns the current time, it is replaced by a fake clock in tests
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Config of circuit breaker, zero values use defaults
+type Config struct {
+	Name string
+	// Window is the period the error and slow call rates are computed over, default 10s
+	Window time.Duration
+	// MinRequests is the number of calls in window before the breaker may trip, default 20
+	MinRequests int
+	// ErrorRate trips the breaker when reached, default 0.5
+	ErrorRate float64
+	// SlowCallDuration marks calls slower than it as slow, zero disables the latency threshold
+	SlowCallDuration time.Duration
+	// SlowCallRate trips the breaker when reached, default 0.5
+	SlowCallRate float64
+	// OpenTimeout is how long the breaker stays open before probing, default 30s
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of successful probes needed to close the breaker, default 1
+	HalfOpenRequests int
+	// OnStateChange is called on every state change, in addition to the log and state gauge.
+	// It is called with the breaker locked so it must not call the breaker.
+	OnStateChange func(name string, from, to State)
+	Clock         Clock
+}
+
+func (c Config) withDefaults() Config {
+	if c.Window <= 0 {
+		c.Window = 10 * time.Second
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.ErrorRate <= 0 {
+		c.ErrorRate = 0.5
+	}
+	if c.SlowCallRate <= 0 {
+		c.SlowCallRate = 0.5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	if c.Clock == nil {
+		c.Clock = systemClock{}
+	}
+	return c
+}
+
+// Breaker is a circuit breaker, it is safe for concurrent use
+type Breaker struct {
+	mu     sync.Mutex
+	config Config
+	state  State
+	// generation changes with state so outcomes of calls allowed in a previous state are ignored
+	generation uint64
+
+	windowStart time.Time
+	requests    int
+	failures    int
+	slowCalls   int
+
+	openedAt  time.Time
+	probes    int
+	successes int
+}
+
+// New returns closed circuit breaker
+func New(config Config) *Breaker {
+	config = config.withDefaults()
+	b := &Breaker{
+		config:      config,
+		windowStart: config.Clock.Now(),
+	}
+	metrics.NewGauge("circuit_breaker_state", "name", config.Name).Set(float64(Closed))
+	return b
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(b.config.Clock.Now())
+	return b.state
+}
+
+// Allow returns ErrOpen when the call must fail fast, otherwise done must be called with the call outcome
+func (b *Breaker) Allow() (done func(failed bool), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.config.Clock.Now()
+	b.refresh(now)
+
+	switch b.state {
+	case Open:
+		metrics.NewCounter("circuit_breaker_rejected_total", "name", b.config.Name).Add(1)
+		return nil, ErrOpen
+	case HalfOpen:
+		if b.probes >= b.config.HalfOpenRequests {
+			metrics.NewCounter("circuit_breaker_rejected_total", "name", b.config.Name).Add(1)
+			return nil, ErrOpen
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	var once sync.Once
+	return func(failed bool) {
+		once.Do(func() {
+			b.record(generation, now, failed)
+		})
+	}, nil
+}
+
+// refresh moves open breaker to half-open and starts a new window, it must be called with lock held
+func (b *Breaker) refresh(now time.Time) {
+	if b.state == Open && now.Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.setState(HalfOpen, now)
+	}
+	if b.state == Closed && now.Sub(b.windowStart) >= b.config.Window {
+		b.resetWindow(now)
+	}
+}
+
+func (b *Breaker) resetWindow(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+	b.slowCalls = 0
+}
+
+func (b *Breaker) record(generation uint64, start time.Time, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	now := b.config.Clock.Now()
+	slow := b.config.SlowCallDuration > 0 && now.Sub(start) > b.config.SlowCallDuration
+
+	switch b.state {
+	case HalfOpen:
+		if failed || slow {
+			b.setState(Open, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenRequests {
+			b.setState(Closed, now)
+		}
+	case Closed:
+		b.refresh(now)
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if slow {
+			b.slowCalls++
+		}
+		if b.requests < b.config.MinRequests {
+			return
+		}
+		if float64(b.failures)/float64(b.requests) >= b.config.ErrorRate ||
+			(b.config.SlowCallDuration > 0 && float64(b.slowCalls)/float64(b.requests) >= b.config.SlowCallRate) {
+			b.setState(Open, now)
+		}
+	}
+}
+
+// setState changes state and reports it, it must be called with lock held
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.probes = 0
+	b.successes = 0
+
+	switch state {
+	case Open:
+		b.openedAt = now
+	case Closed:
+		b.resetWindow(now)
+	}
+
+	log.Printf("circuit breaker state changed: name=%s from=%s to=%s", b.config.Name, from, state)
+	metrics.NewGauge("circuit_breaker_state", "name", b.config.Name).Set(float64(state))
+	if b.config.OnStateChange != nil {
+		b.config.OnStateChange(b.config.Name, from, state)
+	}
+}
+
+// Group holds a circuit breaker per target or method
+type Group struct {
+	mu       sync.Mutex
+	config   Config
+	breakers map[string]*Breaker
+}
+
+// NewGroup returns group whose breakers share config, every breaker is named by config name and its key
+func NewGroup(config Config) *Group {
+	return &Group{
+		config:   config,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get returns breaker of key, creating it on first use
+func (g *Group) Get(key string) *Breaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b, ok := g.breakers[key]
+	if !ok {
+		config := g.config
+		if len(config.Name) > 0 {
+			config.Name += ":" + key
+		} else {
+			config.Name = key
+		}
+		b = New(config)
+		g.breakers[key] = b
+	}
+	return b
+}
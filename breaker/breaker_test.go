@@ -0,0 +1,94 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Add(d time.Duration) { c.now = c.now.Add(d) }
+
+func call(t *testing.T, b *Breaker, failed bool) {
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("call should be allowed in state %v", b.State())
+	}
+	done(failed)
+}
+
+func TestBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var changes []State
+	b := New(Config{
+		Name:        "test",
+		MinRequests: 4,
+		ErrorRate:   0.5,
+		OpenTimeout: time.Second,
+		Clock:       clock,
+		OnStateChange: func(name string, from, to State) {
+			changes = append(changes, to)
+		},
+	})
+
+	call(t, b, false)
+	call(t, b, false)
+	call(t, b, true)
+	if b.State() != Closed {
+		t.Fatalf("breaker should stay closed below min requests")
+	}
+	call(t, b, true)
+	if b.State() != Open {
+		t.Fatalf("breaker should open at error rate")
+	}
+	if _, err := b.Allow(); err != ErrOpen {
+		t.Fatalf("open breaker should fail fast: %v", err)
+	}
+
+	clock.Add(time.Second)
+	if b.State() != HalfOpen {
+		t.Fatalf("breaker should be half-open after timeout")
+	}
+	done, _ := b.Allow()
+	if _, err := b.Allow(); err != ErrOpen {
+		t.Fatalf("half-open breaker should only allow one probe: %v", err)
+	}
+	done(true)
+	if b.State() != Open {
+		t.Fatalf("failed probe should open breaker")
+	}
+
+	clock.Add(time.Second)
+	call(t, b, false)
+	if b.State() != Closed {
+		t.Fatalf("successful probe should close breaker")
+	}
+
+	want := []State{Open, HalfOpen, Open, HalfOpen, Closed}
+	if len(changes) != len(want) {
+		t.Fatalf("bad state changes: %v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("bad state changes: %v", changes)
+		}
+	}
+}
+
+func TestBreakerSlowCalls(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b := New(Config{MinRequests: 2, SlowCallDuration: 100 * time.Millisecond, Clock: clock})
+
+	for i := 0; i < 2; i++ {
+		done, _ := b.Allow()
+		clock.Add(200 * time.Millisecond)
+		done(false)
+	}
+	if b.State() != Open {
+		t.Fatalf("breaker should open at slow call rate")
+	}
+}
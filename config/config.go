@@ -0,0 +1,437 @@
+// Package config loads service settings into tagged structs from defaults, files, environment variables and flags.
+//
+// Fields are keyed by their snake case name, nested struct fields by their path: field Port of field DB is db.port
+// in files and flags and DB_PORT in the environment, after the prefix of WithEnv. Struct tags of fields:
+//
+//	config:"name"     overrides the key, "-" skips the field
+//	default:"value"   is set before loading the sources when the field is zero
+//	required:"true"   fails Load when the field is zero
+//	secret:"true"     redacts the value in String
+//	usage:"text"      is the help of the flag
+//
+// Sources apply in order defaults, files, environment, flags, later sources override earlier ones.
+// Strings of lists are comma separated, maps are k=v pairs and []byte fields read "@path" values from the file path,
+// e.g. to load PEM certificates. Types implementing encoding.TextUnmarshaler parse their own value.
+// Structs implementing Validate() error are validated after loading.
+//
+//	var settings struct {
+//		DB          postgre.Config        `config:"db"`
+//		TLS         tls.Settings          `config:"tls"`
+//		Maintenance grpc.MaintenanceConfig `config:"maintenance"`
+//	}
+//	err := config.Load(&settings, config.WithOptionalFile("config.yaml"), config.WithEnv("ORDERS"),
+//		config.WithFlags(flag.CommandLine, os.Args[1:]))
+//	log.Print(config.String(settings))
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrInvalid is returned when a value cannot be parsed or the loaded settings fail validation
+var ErrInvalid = errors.New("config: invalid")
+
+// Validator is implemented by settings that check themselves after loading
+type Validator interface {
+	Validate() error
+}
+
+// Option configures the sources of Load
+type Option func(*loader)
+
+type file struct {
+	path     string
+	optional bool
+}
+
+type loader struct {
+	files     []file
+	env       bool
+	envPrefix string
+	flags     *flag.FlagSet
+	args      []string
+}
+
+// WithFile loads the YAML, JSON or TOML file of path, the format is chosen by extension
+func WithFile(path string) Option {
+	return func(l *loader) {
+		l.files = append(l.files, file{path: path})
+	}
+}
+
+// WithOptionalFile loads path like WithFile when it exists
+func WithOptionalFile(path string) Option {
+	return func(l *loader) {
+		l.files = append(l.files, file{path: path, optional: true})
+	}
+}
+
+// WithEnv loads environment variables, prefix ORDERS reads field db.port from ORDERS_DB_PORT
+func WithEnv(prefix string) Option {
+	return func(l *loader) {
+		l.env = true
+		l.envPrefix = prefix
+	}
+}
+
+// WithFlags defines a flag of every field on fs, e.g. -db.port, and parses args with it
+func WithFlags(fs *flag.FlagSet, args []string) Option {
+	return func(l *loader) {
+		l.flags = fs
+		l.args = args
+	}
+}
+
+// field is a settable leaf of the settings
+type field struct {
+	path  []string
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+func (f field) key() string {
+	return strings.Join(f.path, ".")
+}
+
+func (f field) secret() bool {
+	secret, _ := strconv.ParseBool(f.tag.Get("secret"))
+	return secret
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// snakeCase returns name in snake case keeping acronyms together, SSLMode is ssl_mode and ProjectID project_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// fieldKey returns the key of struct field sf and whether it is loaded
+func fieldKey(sf reflect.StructField) (string, bool) {
+	if len(sf.PkgPath) > 0 {
+		return "", false
+	}
+	switch name := sf.Tag.Get("config"); name {
+	case "-":
+		return "", false
+	case "":
+		return snakeCase(sf.Name), true
+	default:
+		return name, true
+	}
+}
+
+// isLeaf reports whether values of t are set as a whole rather than field by field
+func isLeaf(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	return t.Kind() != reflect.Struct || t == timeType
+}
+
+// loadable reports whether values of t can be loaded, functions, channels, interfaces and pointers cannot
+func loadable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Interface, reflect.Ptr, reflect.UnsafePointer:
+		return false
+	}
+	return true
+}
+
+// fields returns the leaves of struct v
+func fields(v reflect.Value, path []string) []field {
+	var leaves []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key, ok := fieldKey(sf)
+		if !ok || !loadable(sf.Type) {
+			continue
+		}
+
+		fieldPath := append(append([]string{}, path...), key)
+		if sf.Anonymous && !isLeaf(sf.Type) {
+			fieldPath = path
+		}
+		if isLeaf(sf.Type) {
+			leaves = append(leaves, field{path: fieldPath, value: v.Field(i), tag: sf.Tag})
+			continue
+		}
+		leaves = append(leaves, fields(v.Field(i), fieldPath)...)
+	}
+	return leaves
+}
+
+// Load fills the struct pointed to by dst from defaults and the sources of opts, then validates it
+func Load(dst interface{}, opts ...Option) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load needs a pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+
+	l := &loader{}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	leaves := fields(v, nil)
+	for _, f := range leaves {
+		def, ok := f.tag.Lookup("default")
+		if !ok || !f.value.IsZero() {
+			continue
+		}
+		if err := setString(f.value, def); err != nil {
+			return fmt.Errorf("%w: default of %s: %v", ErrInvalid, f.key(), err)
+		}
+	}
+
+	for _, f := range l.files {
+		values, err := readFile(f.path)
+		if os.IsNotExist(err) && f.optional {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := assign(v, values, ""); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalid, f.path, err)
+		}
+	}
+
+	if l.env {
+		if err := l.loadEnv(leaves); err != nil {
+			return err
+		}
+	}
+	if l.flags != nil {
+		if err := l.loadFlags(leaves); err != nil {
+			return err
+		}
+	}
+
+	return validate(v, leaves)
+}
+
+// envName returns the environment variable of f
+func (l *loader) envName(f field) string {
+	name := strings.ToUpper(strings.Join(f.path, "_"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(l.envPrefix) > 0 {
+		return l.envPrefix + "_" + name
+	}
+	return name
+}
+
+func (l *loader) loadEnv(leaves []field) error {
+	for _, f := range leaves {
+		name := l.envName(f)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setString(f.value, value); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalid, name, err)
+		}
+	}
+	return nil
+}
+
+// flagValue sets a field from a flag
+type flagValue struct {
+	f field
+}
+
+func (v *flagValue) String() string {
+	if v == nil || !v.f.value.IsValid() {
+		return ""
+	}
+	return format(v.f)
+}
+
+func (v *flagValue) Set(s string) error {
+	return setString(v.f.value, s)
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.f.value.Kind() == reflect.Bool
+}
+
+func (l *loader) loadFlags(leaves []field) error {
+	for _, f := range leaves {
+		l.flags.Var(&flagValue{f: f}, f.key(), f.tag.Get("usage"))
+	}
+
+	if err := l.flags.Parse(l.args); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return nil
+}
+
+// setString parses s into v
+func setString(v reflect.Value, s string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return setBytes(v, s)
+		}
+		var items []string
+		if len(strings.TrimSpace(s)) > 0 {
+			items = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setString(slice.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for _, pair := range strings.Split(s, ",") {
+			if len(strings.TrimSpace(pair)) == 0 {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("%q is not key=value", pair)
+			}
+			key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+			if err := setString(key, strings.TrimSpace(kv[0])); err != nil {
+				return err
+			}
+			if err := setString(value, strings.TrimSpace(kv[1])); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// setBytes sets []byte v to s or to the content of file path of "@path"
+func setBytes(v reflect.Value, s string) error {
+	b := []byte(s)
+	if strings.HasPrefix(s, "@") {
+		var err error
+		if b, err = ioutil.ReadFile(s[1:]); err != nil {
+			return err
+		}
+	}
+	v.SetBytes(b)
+	return nil
+}
+
+// validate checks required fields and calls Validate of v and its nested structs
+func validate(v reflect.Value, leaves []field) error {
+	var problems []string
+	for _, f := range leaves {
+		if required, _ := strconv.ParseBool(f.tag.Get("required")); required && f.value.IsZero() {
+			problems = append(problems, f.key()+" is required")
+		}
+	}
+	problems = append(problems, validators(v, "")...)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalid, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validators(v reflect.Value, path string) []string {
+	var problems []string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key, ok := fieldKey(sf)
+		if !ok || isLeaf(sf.Type) {
+			continue
+		}
+		fieldPath := path
+		if !sf.Anonymous {
+			fieldPath = strings.TrimPrefix(path+"."+key, ".")
+		}
+		problems = append(problems, validators(v.Field(i), fieldPath)...)
+	}
+
+	if validator, ok := v.Addr().Interface().(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			if len(path) > 0 {
+				return append(problems, path+": "+err.Error())
+			}
+			return append(problems, err.Error())
+		}
+	}
+	return problems
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 1
+	case "info":
+		*l = 2
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+// window is text like ratelimit.Limit
+type window struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (w window) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d/%s", w.Requests, w.Period)), nil
+}
+
+func (w *window) UnmarshalText(text []byte) error {
+	parts := strings.SplitN(string(text), "/", 2)
+	if len(parts) != 2 {
+		return errors.New("want <requests>/<period>")
+	}
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return err
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return err
+	}
+	*w = window{Requests: requests, Period: period}
+	return nil
+}
+
+type db struct {
+	Host        string `required:"true"`
+	Port        string `default:"5432"`
+	Password    string `secret:"true"`
+	MaxOpen     int
+	PingTimeout time.Duration
+	CA          []byte
+}
+
+type settings struct {
+	DB       db `config:"db"`
+	LogLevel level
+	Debug    bool
+	Tags     []string
+	Routes   map[string]string
+	Products map[int]string
+	Port     int `default:"8080" usage:"listen port"`
+	OnChange func()
+}
+
+func (s settings) Validate() error {
+	if s.Port <= 0 {
+		return errors.New("port must be positive")
+	}
+	return nil
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Host":                     "host",
+		"MaxOpen":                  "max_open",
+		"SSLMode":                  "ssl_mode",
+		"CA":                       "ca",
+		"ProjectID":                "project_id",
+		"FirebaseClientPrivateKey": "firebase_client_private_key",
+	}
+	for name, want := range tests {
+		if got := snakeCase(name); got != want {
+			t.Errorf("%s: want %s, got %s", name, want, got)
+		}
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+db:
+  host: yaml
+  max_open: 10
+  ping_timeout: 2s
+log_level: debug
+tags: [a, b]
+routes:
+  orders: /orders.v1.Orders/*
+products:
+  1: pln
+`,
+		"config.json": `{"db": {"host": "json", "maxOpen": 10, "ping_timeout": "2s"}, "log_level": "debug",
+"tags": ["a", "b"], "routes": {"orders": "/orders.v1.Orders/*"}, "products": {"1": "pln"}}`,
+		"config.toml": `
+log_level = "debug"
+tags = ["a", "b"]
+
+[db]
+host = "toml"
+max_open = 10
+ping_timeout = "2s"
+
+[routes]
+orders = "/orders.v1.Orders/*"
+
+[products]
+1 = "pln"
+`,
+	}
+
+	for name, content := range files {
+		var s settings
+		if err := Load(&s, WithFile(writeFile(t, name, content))); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		format := strings.TrimPrefix(filepath.Ext(name), ".")
+		if s.DB.Host != format || s.DB.MaxOpen != 10 || s.DB.PingTimeout != 2*time.Second || s.DB.Port != "5432" {
+			t.Errorf("%s: unexpected db %+v", name, s.DB)
+		}
+		if s.LogLevel != 1 || len(s.Tags) != 2 || s.Routes["orders"] != "/orders.v1.Orders/*" || s.Products[1] != "pln" {
+			t.Errorf("%s: unexpected settings %+v", name, s)
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", "db:\n  host: file\n  port: \"1\"\nport: 1\n")
+	os.Setenv("APP_DB_PORT", "2")
+	os.Setenv("APP_PORT", "2")
+	os.Setenv("APP_TAGS", "x, y")
+	defer os.Unsetenv("APP_DB_PORT")
+	defer os.Unsetenv("APP_PORT")
+	defer os.Unsetenv("APP_TAGS")
+
+	var s settings
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	err := Load(&s, WithFile(path), WithEnv("APP"), WithFlags(fs, []string{"-port", "3", "-debug", "-routes", "a=1,b=2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.DB.Host != "file" || s.DB.Port != "2" || s.Port != 3 || !s.Debug {
+		t.Fatalf("later sources should override earlier ones, got %+v", s)
+	}
+	if len(s.Tags) != 2 || s.Tags[1] != "y" || s.Routes["b"] != "2" {
+		t.Fatalf("lists and maps should be parsed, got %+v", s)
+	}
+	if usage := fs.Lookup("port").Usage; usage != "listen port" {
+		t.Fatalf("unexpected usage %q", usage)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	var s settings
+	err := Load(&s, WithOptionalFile(filepath.Join(t.TempDir(), "missing.yaml")))
+	if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "db.host is required") {
+		t.Fatalf("missing required field should fail, got %v", err)
+	}
+
+	s = settings{}
+	s.DB.Host = "localhost"
+	s.Port = -1
+	if err := Load(&s); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "port must be positive") {
+		t.Fatalf("Validate should fail, got %v", err)
+	}
+
+	path := writeFile(t, "config.yaml", "db:\n  host: localhost\nlog_level: trace\n")
+	if err := Load(&settings{}, WithFile(path)); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "log_level") {
+		t.Fatalf("bad value should fail, got %v", err)
+	}
+
+	path = writeFile(t, "config.json", `{"db": {"host": "a", "Host": "b"}}`)
+	if err := Load(&settings{}, WithFile(path)); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "ambiguous") {
+		t.Fatalf("keys matching the same field should fail, got %v", err)
+	}
+
+	if err := Load(&settings{}, WithFile(filepath.Join(t.TempDir(), "missing.yaml"))); !os.IsNotExist(err) {
+		t.Fatalf("missing file should fail, got %v", err)
+	}
+}
+
+func TestLoadBytesFromFile(t *testing.T) {
+	ca := writeFile(t, "ca.pem", "-----BEGIN CERTIFICATE-----")
+	os.Setenv("DB_HOST", "localhost")
+	os.Setenv("DB_CA", "@"+ca)
+	defer os.Unsetenv("DB_HOST")
+	defer os.Unsetenv("DB_CA")
+
+	var s settings
+	if err := Load(&s, WithEnv("")); err != nil {
+		t.Fatal(err)
+	}
+	if string(s.DB.CA) != "-----BEGIN CERTIFICATE-----" {
+		t.Fatalf("CA should be read from file, got %q", s.DB.CA)
+	}
+}
+
+func TestString(t *testing.T) {
+	s := settings{DB: db{Host: "localhost", Password: "hunter2", CA: []byte("pem")}}
+	out := String(s)
+
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, "db.password=******") {
+		t.Fatalf("password should be redacted:\n%s", out)
+	}
+	if !strings.Contains(out, "db.host=localhost\n") || !strings.Contains(out, "db.ca=<3 bytes>") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	if strings.Contains(out, "on_change") {
+		t.Fatalf("functions should be skipped:\n%s", out)
+	}
+
+	if out := String(struct{ Window window }{window{Requests: 100, Period: time.Minute}}); out != "window=100/1m0s\n" {
+		t.Fatalf("text marshalers should print their text:\n%s", out)
+	}
+}
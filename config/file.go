@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// readFile decodes the YAML, JSON or TOML file of path into a tree of maps, lists and scalars
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("config: %s: unknown file format %q", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	return values, nil
+}
+
+// lookup returns the value of key in m, keys match case insensitively the snake case key or the field name.
+// Several matching keys, e.g. ssl_mode and SSLMode, are ambiguous.
+func lookup(m map[string]interface{}, key, name string) (interface{}, bool, error) {
+	var matches []string
+	for k := range m {
+		if strings.EqualFold(k, key) || strings.EqualFold(k, name) {
+			matches = append(matches, k)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return m[matches[0]], true, nil
+	}
+	sort.Strings(matches)
+	return nil, false, fmt.Errorf("ambiguous keys %s", strings.Join(matches, ", "))
+}
+
+// stringKeys returns m with string keys, YAML decodes maps with non-string keys as map[interface{}]interface{}
+func stringKeys(raw interface{}) (map[string]interface{}, bool) {
+	switch m := raw.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		values := make(map[string]interface{}, len(m))
+		for k, value := range m {
+			values[fmt.Sprint(k)] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// assign sets v to the decoded file value raw, path locates v in errors
+func assign(v reflect.Value, raw interface{}, path string) error {
+	if raw == nil {
+		return nil
+	}
+	if err := assignValue(v, raw, path); err != nil {
+		if len(path) == 0 {
+			return err
+		}
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+func assignValue(v reflect.Value, raw interface{}, path string) error {
+	if s, ok := raw.(string); ok {
+		return setString(v, s)
+	}
+	if t, ok := raw.(time.Time); ok && v.Type() == timeType {
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch {
+	case !isLeaf(v.Type()):
+		m, ok := stringKeys(raw)
+		if !ok {
+			return fmt.Errorf("want table, got %T", raw)
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			key, ok := fieldKey(sf)
+			if !ok || !loadable(sf.Type) {
+				continue
+			}
+			if sf.Anonymous && !isLeaf(sf.Type) {
+				if err := assign(v.Field(i), m, path); err != nil {
+					return err
+				}
+				continue
+			}
+			fieldPath := strings.TrimPrefix(path+"."+key, ".")
+			value, ok, err := lookup(m, key, sf.Name)
+			if err != nil {
+				return fmt.Errorf("%s: %v", fieldPath, err)
+			}
+			if ok {
+				if err := assign(v.Field(i), value, fieldPath); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("want list, got %T", raw)
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assign(slice.Index(i), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case v.Kind() == reflect.Map:
+		m, ok := stringKeys(raw)
+		if !ok {
+			return fmt.Errorf("want table, got %T", raw)
+		}
+		values := reflect.MakeMap(v.Type())
+		for k, item := range m {
+			key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+			if err := setString(key, k); err != nil {
+				return err
+			}
+			if err := assign(value, item, path+"."+k); err != nil {
+				return err
+			}
+			values.SetMapIndex(key, value)
+		}
+		v.Set(values)
+		return nil
+	}
+
+	// numbers and booleans of the file parse like their string form
+	return setString(v, fmt.Sprint(raw))
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// redacted replaces the value of secret fields
+const redacted = "******"
+
+// format returns the value of f for printing, secrets are redacted unless they are empty, bytes such as
+// PEM certificates are summarized by their length and types implementing encoding.TextMarshaler print their text
+// so that it can be loaded again
+func format(f field) string {
+	if f.secret() && !f.value.IsZero() {
+		return redacted
+	}
+	switch v := f.value.Interface().(type) {
+	case []byte:
+		if len(v) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("<%d bytes>", len(v))
+	case encoding.TextMarshaler:
+		if text, err := v.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// String returns the settings of struct v as key=value lines in field order, values of secret fields are redacted.
+// It is safe to log.
+func String(v interface{}) string {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return fmt.Sprint(v)
+	}
+
+	var b strings.Builder
+	for _, f := range fields(value, nil) {
+		b.WriteString(f.key())
+		b.WriteByte('=')
+		b.WriteString(format(f))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
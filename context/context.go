@@ -23,6 +23,14 @@ var (
 	CtxUserInfo = contextKey("user_info")
 	// CtxCID is context key for user info
 	CtxCID = contextKey("cID")
+	// CtxRequestID is context key for request id
+	CtxRequestID = contextKey("request_id")
+	// CtxServiceIdentity is context key for identity of the calling service
+	CtxServiceIdentity = contextKey("service_identity")
+	// CtxReadPrimary is context key for routing reads to the primary database
+	CtxReadPrimary = contextKey("read_primary")
+	// CtxTx is context key for the current database transaction
+	CtxTx = contextKey("db_tx")
 )
 
 // GetContextAsString return context value as type string
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cctx "github.com/budhip/common/context"
+	"github.com/budhip/common/metrics"
+)
+
+// Balancer picks the replica serving a read
+type Balancer int
+
+const (
+	// RoundRobin spreads reads evenly over healthy replicas
+	RoundRobin Balancer = iota
+	// LeastLatency sends reads to the healthy replica with the lowest health check latency
+	LeastLatency
+)
+
+var balancers = map[string]Balancer{
+	"round-robin":   RoundRobin,
+	"least-latency": LeastLatency,
+}
+
+func (b Balancer) String() string {
+	for name, balancer := range balancers {
+		if balancer == b {
+			return name
+		}
+	}
+	return fmt.Sprintf("Balancer(%d)", int(b))
+}
+
+// UnmarshalText parses balancer "round-robin" or "least-latency", e.g. to load it with the config package
+func (b *Balancer) UnmarshalText(text []byte) error {
+	balancer, ok := balancers[strings.ToLower(strings.TrimSpace(string(text)))]
+	if !ok {
+		return fmt.Errorf("database: unknown balancer %q", text)
+	}
+	*b = balancer
+	return nil
+}
+
+// ClusterConfig configures a Cluster
+type ClusterConfig struct {
+	// Name labels the cluster metrics
+	Name     string
+	Balancer Balancer
+	// HealthCheckInterval defaults to 5s
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout bounds every health check ping, defaults to 1s
+	HealthCheckTimeout time.Duration
+	// FailureThreshold is the number of consecutive failed health checks that eject a replica, defaults to 3.
+	// An ejected replica rejoins on its first successful health check.
+	FailureThreshold int
+}
+
+// latencyWeight is the weight of the latest health check in the latency moving average
+const latencyWeight = 0.3
+
+type replica struct {
+	db    *sql.DB
+	index int
+
+	mu       sync.Mutex
+	healthy  bool
+	failures int
+	latency  time.Duration
+}
+
+func (r *replica) state() (bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.healthy, r.latency
+}
+
+// Cluster routes writes and transactions to the primary and reads to healthy replicas.
+// Reads fall back to the primary when every replica is ejected. It is safe for concurrent use.
+type Cluster struct {
+	primary  *sql.DB
+	replicas []*replica
+	config   ClusterConfig
+	next     uint32
+	healthy  metrics.Gauge
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewCluster returns cluster of primary and replicas and starts health checking the replicas, Close stops it.
+// Replicas are healthy until the first health check, which runs in the background right away.
+func NewCluster(primary *sql.DB, replicas []*sql.DB, config ClusterConfig) *Cluster {
+	c := newCluster(primary, replicas, config)
+	if len(replicas) > 0 {
+		go c.watch()
+	}
+	return c
+}
+
+// OpenCluster opens the databases of primary and replicas, e.g. DB of the mysql or postgre package, and returns
+// their cluster. Databases opened before a failure are closed.
+func OpenCluster(primary func() (*sql.DB, error), replicas []func() (*sql.DB, error),
+	config ClusterConfig) (*Cluster, error) {
+	primaryDB, err := primary()
+	if err != nil {
+		return nil, err
+	}
+
+	var replicaDBs []*sql.DB
+	for _, replica := range replicas {
+		db, err := replica()
+		if err != nil {
+			primaryDB.Close()
+			for _, db := range replicaDBs {
+				db.Close()
+			}
+			return nil, err
+		}
+		replicaDBs = append(replicaDBs, db)
+	}
+
+	return NewCluster(primaryDB, replicaDBs, config), nil
+}
+
+// newCluster returns cluster without health checking, replicas are healthy until CheckHealth
+func newCluster(primary *sql.DB, replicas []*sql.DB, config ClusterConfig) *Cluster {
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = 5 * time.Second
+	}
+	if config.HealthCheckTimeout <= 0 {
+		config.HealthCheckTimeout = time.Second
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 3
+	}
+
+	c := &Cluster{
+		primary: primary,
+		config:  config,
+		healthy: metrics.NewGauge("db_cluster_healthy_replicas", "name", config.Name),
+		stop:    make(chan struct{}),
+	}
+	for i, db := range replicas {
+		c.replicas = append(c.replicas, &replica{db: db, index: i, healthy: true})
+	}
+	c.healthy.Set(float64(len(replicas)))
+	return c
+}
+
+// WithPrimary returns context that routes reads to the primary, e.g. to read your own writes despite replication lag
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cctx.CtxReadPrimary, true)
+}
+
+func readPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(cctx.CtxReadPrimary).(bool)
+	return primary
+}
+
+func (c *Cluster) watch() {
+	// measure latencies before the first interval, LeastLatency would send every read to the first replica
+	c.CheckHealth(context.Background())
+
+	ticker := time.NewTicker(c.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.CheckHealth(context.Background())
+		}
+	}
+}
+
+// CheckHealth pings every replica, ejecting replicas over the failure threshold and restoring recovered ones
+func (c *Cluster) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range c.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			c.check(ctx, r)
+		}(r)
+	}
+	wg.Wait()
+
+	healthy := 0
+	for _, r := range c.replicas {
+		if ok, _ := r.state(); ok {
+			healthy++
+		}
+	}
+	c.healthy.Set(float64(healthy))
+}
+
+func (c *Cluster) check(ctx context.Context, r *replica) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.HealthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := r.db.PingContext(ctx)
+	latency := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.failures++
+		if r.healthy && r.failures >= c.config.FailureThreshold {
+			r.healthy = false
+			log.Printf("database cluster %s: replica %d ejected after %d failed health checks: %v",
+				c.config.Name, r.index, r.failures, err)
+		}
+		return
+	}
+
+	if !r.healthy {
+		log.Printf("database cluster %s: replica %d is healthy again", c.config.Name, r.index)
+	}
+	r.healthy = true
+	r.failures = 0
+	if r.latency == 0 {
+		r.latency = latency
+	} else {
+		r.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(r.latency))
+	}
+}
+
+// Primary returns the primary
+func (c *Cluster) Primary() *sql.DB {
+	return c.primary
+}
+
+// Reader returns the db serving reads of ctx, the primary when ctx is marked by WithPrimary or no replica is healthy
+func (c *Cluster) Reader(ctx context.Context) *sql.DB {
+	if readPrimary(ctx) || len(c.replicas) == 0 {
+		return c.primary
+	}
+
+	switch c.config.Balancer {
+	case LeastLatency:
+		var best *replica
+		var bestLatency time.Duration
+		for _, r := range c.replicas {
+			if ok, latency := r.state(); ok && (best == nil || latency < bestLatency) {
+				best, bestLatency = r, latency
+			}
+		}
+		if best != nil {
+			return best.db
+		}
+	default:
+		start := atomic.AddUint32(&c.next, 1)
+		for i := 0; i < len(c.replicas); i++ {
+			r := c.replicas[(int(start)+i)%len(c.replicas)]
+			if ok, _ := r.state(); ok {
+				return r.db
+			}
+		}
+	}
+
+	return c.primary
+}
+
+// ExecContext executes query on the primary
+func (c *Cluster) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.primary.ExecContext(ctx, query, args...)
+}
+
+// QueryContext executes read query on a replica, see Reader
+func (c *Cluster) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.Reader(ctx).QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext executes read query on a replica, see Reader
+func (c *Cluster) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.Reader(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx starts transaction on the primary, reads of the transaction go to the primary too
+func (c *Cluster) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return c.primary.BeginTx(ctx, opts)
+}
+
+// PingContext pings the primary
+func (c *Cluster) PingContext(ctx context.Context) error {
+	return c.primary.PingContext(ctx)
+}
+
+// Close stops health checking and closes the primary and every replica
+func (c *Cluster) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+
+	var errs []string
+	if err := c.primary.Close(); err != nil {
+		errs = append(errs, "primary: "+err.Error())
+	}
+	for _, r := range c.replicas {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("replica %d: %v", r.index, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("database: close cluster: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pingDriver opens connections that fail pings while down is set and answer them after delay
+type pingDriver struct {
+	mu    sync.Mutex
+	down  bool
+	delay time.Duration
+}
+
+func (d *pingDriver) setDown(down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down = down
+}
+
+func (d *pingDriver) Open(string) (driver.Conn, error) {
+	return pingConn{d: d}, nil
+}
+
+type pingConn struct {
+	fakeConn
+	d *pingDriver
+}
+
+func (c pingConn) Ping(context.Context) error {
+	time.Sleep(c.d.delay)
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if c.d.down {
+		return errors.New("replica down")
+	}
+	return nil
+}
+
+type pingConnector struct {
+	d *pingDriver
+}
+
+func (c pingConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c pingConnector) Driver() driver.Driver                        { return c.d }
+
+func TestCluster(t *testing.T) {
+	primary := sql.OpenDB(pingConnector{d: &pingDriver{}})
+	drivers := []*pingDriver{{}, {}}
+	replicas := []*sql.DB{sql.OpenDB(pingConnector{d: drivers[0]}), sql.OpenDB(pingConnector{d: drivers[1]})}
+
+	cluster := newCluster(primary, replicas, ClusterConfig{
+		Name:             "test",
+		FailureThreshold: 2,
+	})
+
+	ctx := context.Background()
+	cluster.CheckHealth(ctx)
+	if first, second := cluster.Reader(ctx), cluster.Reader(ctx); first == second || first == primary || second == primary {
+		t.Fatalf("reads should be spread over replicas")
+	}
+	if cluster.Reader(WithPrimary(ctx)) != primary {
+		t.Fatalf("WithPrimary should read from primary")
+	}
+
+	drivers[0].setDown(true)
+	cluster.CheckHealth(ctx)
+	if cluster.Reader(ctx) != replicas[0] && cluster.Reader(ctx) != replicas[0] {
+		t.Fatalf("replica should stay until the failure threshold")
+	}
+	cluster.CheckHealth(ctx)
+	for i := 0; i < 4; i++ {
+		if cluster.Reader(ctx) != replicas[1] {
+			t.Fatalf("unhealthy replica should be ejected")
+		}
+	}
+
+	drivers[1].setDown(true)
+	cluster.CheckHealth(ctx)
+	cluster.CheckHealth(ctx)
+	if cluster.Reader(ctx) != primary {
+		t.Fatalf("reads should fall back to primary")
+	}
+
+	drivers[0].setDown(false)
+	cluster.CheckHealth(ctx)
+	if cluster.Reader(ctx) != replicas[0] {
+		t.Fatalf("recovered replica should rejoin")
+	}
+}
+
+func TestClusterLeastLatency(t *testing.T) {
+	primary := sql.OpenDB(pingConnector{d: &pingDriver{}})
+	replicas := []*sql.DB{
+		sql.OpenDB(pingConnector{d: &pingDriver{delay: 20 * time.Millisecond}}),
+		sql.OpenDB(pingConnector{d: &pingDriver{}}),
+	}
+
+	cluster := newCluster(primary, replicas, ClusterConfig{
+		Name:     "test",
+		Balancer: LeastLatency,
+	})
+
+	ctx := context.Background()
+	cluster.CheckHealth(ctx)
+	if cluster.Reader(ctx) != replicas[1] {
+		t.Fatalf("reads should go to the fastest replica")
+	}
+}
+
+func TestOpenCluster(t *testing.T) {
+	var opened []*sql.DB
+	open := func(err error) func() (*sql.DB, error) {
+		return func() (*sql.DB, error) {
+			if err != nil {
+				return nil, err
+			}
+			db := sql.OpenDB(pingConnector{d: &pingDriver{}})
+			opened = append(opened, db)
+			return db, nil
+		}
+	}
+
+	_, err := OpenCluster(open(nil), []func() (*sql.DB, error){open(nil), open(errors.New("bad config"))},
+		ClusterConfig{Name: "test"})
+	if err == nil {
+		t.Fatalf("failing replica should fail the cluster")
+	}
+	for i, db := range opened {
+		if err := db.Ping(); err == nil {
+			t.Fatalf("database %d should be closed", i)
+		}
+	}
+
+	cluster, err := OpenCluster(open(nil), []func() (*sql.DB, error){open(nil)}, ClusterConfig{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	if cluster.Primary() != opened[len(opened)-2] {
+		t.Fatalf("bad primary")
+	}
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Limits bounds the connection pool of a database, zero values keep the database/sql defaults
+type Limits struct {
+	MaxOpen     int
+	MaxIdle     int
+	MaxLifetime time.Duration
+	MaxIdleTime time.Duration
+}
+
+// SetLimits applies limits to the connection pool of db
+func SetLimits(db *sql.DB, limits Limits) {
+	if limits.MaxOpen > 0 {
+		db.SetMaxOpenConns(limits.MaxOpen)
+	}
+	if limits.MaxIdle > 0 {
+		db.SetMaxIdleConns(limits.MaxIdle)
+	}
+	if limits.MaxLifetime > 0 {
+		db.SetConnMaxLifetime(limits.MaxLifetime)
+	}
+	if limits.MaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(limits.MaxIdleTime)
+	}
+}
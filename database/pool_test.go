@@ -0,0 +1,21 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSetLimits(t *testing.T) {
+	db := sql.OpenDB(pingConnector{d: &pingDriver{}})
+	defer db.Close()
+
+	SetLimits(db, Limits{MaxOpen: 7, MaxLifetime: time.Minute})
+	if stats := db.Stats(); stats.MaxOpenConnections != 7 {
+		t.Fatalf("bad max open connections: %v", stats.MaxOpenConnections)
+	}
+	SetLimits(db, Limits{})
+	if stats := db.Stats(); stats.MaxOpenConnections != 7 {
+		t.Fatalf("zero limits should keep the pool settings: %v", stats.MaxOpenConnections)
+	}
+}
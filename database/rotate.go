@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log"
+	"sync"
+
+	"github.com/budhip/common/secrets"
+)
+
+// defaultMaxIdle is the idle connection limit of database/sql when it is not set
+const defaultMaxIdle = 2
+
+// CloseIdle closes the idle connections of db so they are re-opened, e.g. with a rotated password.
+// maxIdle restores the idle connection limit of db, values below 1 restore the database/sql default.
+func CloseIdle(db *sql.DB, maxIdle int) {
+	if maxIdle <= 0 {
+		maxIdle = defaultMaxIdle
+	}
+	db.SetMaxIdleConns(-1)
+	db.SetMaxIdleConns(maxIdle)
+}
+
+// rotatingConnector opens connections with the current password of a secret
+type rotatingConnector struct {
+	driver   driver.Driver
+	provider secrets.Provider
+	name     string
+	open     func(password string) (driver.Connector, error)
+	rotated  func()
+
+	mu        sync.Mutex
+	password  string
+	connector driver.Connector
+}
+
+// NewRotatingConnector returns connector whose new connections authenticate with the current value of
+// secret name of provider, open returns the driver connector of a password. rotated is called in its own
+// goroutine when the password changed since the previous connection, e.g. to CloseIdle. Connections in use
+// keep their session until they are closed. Wrap provider in secrets.NewCache to bound the lookups.
+func NewRotatingConnector(
+	d driver.Driver,
+	provider secrets.Provider,
+	name string,
+	open func(password string) (driver.Connector, error),
+	rotated func(),
+) driver.Connector {
+	return &rotatingConnector{driver: d, provider: provider, name: name, open: open, rotated: rotated}
+}
+
+func (c *rotatingConnector) current(ctx context.Context) (driver.Connector, error) {
+	password, err := secrets.String(ctx, c.provider, c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connector != nil && password == c.password {
+		return c.connector, nil
+	}
+
+	connector, err := c.open(password)
+	if err != nil {
+		return nil, err
+	}
+	if c.connector != nil {
+		log.Printf("database: password %s rotated, re-opening connections", c.name)
+		if c.rotated != nil {
+			go c.rotated()
+		}
+	}
+	c.password, c.connector = password, connector
+	return connector, nil
+}
+
+func (c *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	connector, err := c.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c *rotatingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// OpenWithSecret returns db whose connections authenticate with the current value of secret name of provider,
+// see NewRotatingConnector. Idle connections are closed when the rotation is noticed, MaxLifetime of limits bounds
+// how long connections in use keep the old password.
+func OpenWithSecret(
+	d driver.Driver,
+	provider secrets.Provider,
+	name string,
+	open func(password string) (driver.Connector, error),
+	limits Limits,
+) *sql.DB {
+	var db *sql.DB
+	db = sql.OpenDB(NewRotatingConnector(d, provider, name, open, func() {
+		CloseIdle(db, limits.MaxIdle)
+	}))
+	SetLimits(db, limits)
+	return db
+}
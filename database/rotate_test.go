@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+)
+
+type passwordProvider struct {
+	mu       sync.Mutex
+	password string
+}
+
+func (p *passwordProvider) set(password string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.password = password
+}
+
+func (p *passwordProvider) Get(context.Context, string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return []byte(p.password), nil
+}
+
+// passwordConnector records the password of every connection it opens
+type passwordConnector struct {
+	password string
+	opened   chan string
+}
+
+func (c passwordConnector) Connect(context.Context) (driver.Conn, error) {
+	c.opened <- c.password
+	return fakeConn{}, nil
+}
+
+func (c passwordConnector) Driver() driver.Driver { return &fakeDriver{} }
+
+func TestRotatingConnector(t *testing.T) {
+	provider := &passwordProvider{password: "old"}
+	opened := make(chan string, 4)
+	rotated := make(chan struct{}, 1)
+
+	open := func(password string) (driver.Connector, error) {
+		return passwordConnector{password: password, opened: opened}, nil
+	}
+	db := sql.OpenDB(NewRotatingConnector(&fakeDriver{}, provider, "password", open, func() {
+		rotated <- struct{}{}
+	}))
+	defer db.Close()
+
+	ctx := context.Background()
+	first, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if password := <-opened; password != "old" {
+		t.Fatalf("want old, got %s", password)
+	}
+
+	provider.set("new")
+	second, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if password := <-opened; password != "new" {
+		t.Fatalf("rotated password should be used by new connections, got %s", password)
+	}
+
+	select {
+	case <-rotated:
+	case <-time.After(time.Second):
+		t.Fatalf("rotation not reported")
+	}
+}
+
+func TestCloseIdle(t *testing.T) {
+	db := sql.OpenDB(connector{d: &fakeDriver{}})
+	defer db.Close()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if idle := db.Stats().Idle; idle != 1 {
+		t.Fatalf("want 1 idle connection, got %d", idle)
+	}
+
+	CloseIdle(db, 0)
+	if idle := db.Stats().Idle; idle != 0 {
+		t.Fatalf("idle connections should be closed, got %d", idle)
+	}
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	cctx "github.com/budhip/common/context"
+	"github.com/budhip/common/metrics"
+)
+
+// StatsCollector exports sql.DBStats of named pools as gauges labeled by pool, e.g. to tune MaxOpen and MaxIdle.
+// Wait count and wait duration are cumulative since the pool was opened.
+type StatsCollector struct {
+	mu    sync.Mutex
+	pools map[string]*sql.DB
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewStatsCollector returns collector exporting the stats of registered pools every interval, Close stops it
+func NewStatsCollector(interval time.Duration) *StatsCollector {
+	c := &StatsCollector{
+		pools: map[string]*sql.DB{},
+		stop:  make(chan struct{}),
+	}
+	if interval > 0 {
+		go c.watch(interval)
+	}
+	return c
+}
+
+func (c *StatsCollector) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.Collect()
+		}
+	}
+}
+
+// Register adds pool db named name, e.g. "users-primary"
+func (c *StatsCollector) Register(name string, db *sql.DB) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pools[name] = db
+}
+
+// Unregister removes pool named name and resets its gauges to 0
+func (c *StatsCollector) Unregister(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pools[name]; !ok {
+		return
+	}
+	delete(c.pools, name)
+	exportStats(name, sql.DBStats{})
+}
+
+// Collect exports the current stats of every registered pool
+func (c *StatsCollector) Collect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, db := range c.pools {
+		exportStats(name, db.Stats())
+	}
+}
+
+// Close stops collecting
+func (c *StatsCollector) Close() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+}
+
+func exportStats(name string, stats sql.DBStats) {
+	gauges := map[string]float64{
+		"db_pool_max_open":             float64(stats.MaxOpenConnections),
+		"db_pool_open":                 float64(stats.OpenConnections),
+		"db_pool_in_use":               float64(stats.InUse),
+		"db_pool_idle":                 float64(stats.Idle),
+		"db_pool_wait_count":           float64(stats.WaitCount),
+		"db_pool_wait_seconds":         stats.WaitDuration.Seconds(),
+		"db_pool_max_idle_closed":      float64(stats.MaxIdleClosed),
+		"db_pool_max_idle_time_closed": float64(stats.MaxIdleTimeClosed),
+		"db_pool_max_lifetime_closed":  float64(stats.MaxLifetimeClosed),
+	}
+	for metric, value := range gauges {
+		metrics.NewGauge(metric, "pool", name).Set(value)
+	}
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// SlowQueryLogger runs queries on db and logs the ones slower than the threshold with the cID and
+// request id of the context. Argument values are redacted, only their types are logged.
+// Queries join the transaction carried in context, see Conn. The duration of QueryContext ends
+// when the first rows are available, not when they are read.
+type SlowQueryLogger struct {
+	name      string
+	db        Executor
+	threshold time.Duration
+}
+
+// NewSlowQueryLogger returns logger of queries slower than threshold on pool db named name
+func NewSlowQueryLogger(name string, db Executor, threshold time.Duration) *SlowQueryLogger {
+	return &SlowQueryLogger{name: name, db: db, threshold: threshold}
+}
+
+// redact returns the types of args
+func redact(args []interface{}) string {
+	types := make([]string, len(args))
+	for i, arg := range args {
+		types[i] = fmt.Sprintf("%T", arg)
+	}
+	return "[" + strings.Join(types, " ") + "]"
+}
+
+func (l *SlowQueryLogger) observe(ctx context.Context, query string, args []interface{}, start time.Time, err error) {
+	duration := time.Since(start)
+	if duration < l.threshold {
+		return
+	}
+
+	metrics.NewCounter("db_slow_queries_total", "pool", l.name).Add(1)
+	log.Printf("slow query: pool=%s duration=%s cID=%s request_id=%s error=%v query=%q args=%s",
+		l.name, duration, cctx.GetContextAsString(ctx, cctx.CtxCID), cctx.GetContextAsString(ctx, cctx.CtxRequestID),
+		err, strings.TrimSpace(whitespace.ReplaceAllString(query, " ")), redact(args))
+}
+
+// ExecContext executes query and logs it when slow
+func (l *SlowQueryLogger) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := Conn(ctx, l.db).ExecContext(ctx, query, args...)
+	l.observe(ctx, query, args, start, err)
+	return result, err
+}
+
+// QueryContext executes query and logs it when slow
+func (l *SlowQueryLogger) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := Conn(ctx, l.db).QueryContext(ctx, query, args...)
+	l.observe(ctx, query, args, start, err)
+	return rows, err
+}
+
+// QueryRowContext executes query and logs it when slow
+func (l *SlowQueryLogger) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := Conn(ctx, l.db).QueryRowContext(ctx, query, args...)
+	l.observe(ctx, query, args, start, row.Err())
+	return row
+}
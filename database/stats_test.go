@@ -0,0 +1,109 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	cctx "github.com/budhip/common/context"
+	"github.com/budhip/common/metrics"
+)
+
+type recordingProvider struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+type recordingMetric struct {
+	p   *recordingProvider
+	key string
+}
+
+func (m recordingMetric) Add(delta float64) {
+	m.p.mu.Lock()
+	defer m.p.mu.Unlock()
+	m.p.values[m.key] += delta
+}
+
+func (m recordingMetric) Set(value float64) {
+	m.p.mu.Lock()
+	defer m.p.mu.Unlock()
+	m.p.values[m.key] = value
+}
+
+func (p *recordingProvider) Counter(name string, labels ...string) metrics.Counter {
+	return recordingMetric{p: p, key: name + "|" + strings.Join(labels, ",")}
+}
+
+func (p *recordingProvider) Gauge(name string, labels ...string) metrics.Gauge {
+	return recordingMetric{p: p, key: name + "|" + strings.Join(labels, ",")}
+}
+
+func (p *recordingProvider) value(key string) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.values[key]
+}
+
+func TestStatsCollector(t *testing.T) {
+	provider := &recordingProvider{values: map[string]float64{}}
+	defer metrics.SetProvider(metrics.CurrentProvider())
+	metrics.SetProvider(provider)
+
+	db := sql.OpenDB(txConnector{d: &txDriver{}})
+	defer db.Close()
+	db.SetMaxOpenConns(7)
+
+	collector := NewStatsCollector(0)
+	defer collector.Close()
+	collector.Register("users", db)
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector.Collect()
+	conn.Close()
+
+	if got := provider.value("db_pool_max_open|pool,users"); got != 7 {
+		t.Fatalf("bad max open: %v", got)
+	}
+	if got := provider.value("db_pool_in_use|pool,users"); got != 1 {
+		t.Fatalf("bad in use: %v", got)
+	}
+
+	collector.Unregister("users")
+	if got := provider.value("db_pool_max_open|pool,users"); got != 0 {
+		t.Fatalf("unregistered pool should be reset: %v", got)
+	}
+}
+
+func TestSlowQueryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	db := sql.OpenDB(txConnector{d: &txDriver{}})
+	defer db.Close()
+
+	ctx := context.WithValue(context.Background(), cctx.CtxCID, "cid-1")
+	logger := NewSlowQueryLogger("users", db, 0)
+	if _, err := logger.ExecContext(ctx, "UPDATE users\n\tSET password = ?", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	if strings.Contains(got, "secret") {
+		t.Fatalf("arguments should be redacted: %s", got)
+	}
+	for _, want := range []string{"pool=users", "cID=cid-1", `query="UPDATE users SET password = ?"`, "args=[string]"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("slow query log should contain %s: %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+
+	cctx "github.com/budhip/common/context"
+	"github.com/budhip/common/retry"
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL and postgres errors of transactions aborted by the server that succeed when retried
+const (
+	mysqlLockWaitTimeout   = 1205
+	mysqlDeadlock          = 1213
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// Beginner starts transactions, it is implemented by *sql.DB and *Cluster
+type Beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Executor runs queries, it is implemented by *sql.DB, *sql.Tx and *Cluster
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// TxOptions configures WithTx
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// Retry of deadlocks and serialization failures, MaxAttempts defaults to 3 with retry.DefaultBackoff.
+	// MaxAttempts 1 disables retry.
+	Retry retry.Policy
+}
+
+// txState is the transaction of db carried in context, outer is the transaction of another db it runs in
+type txState struct {
+	db    Beginner
+	tx    *sql.Tx
+	depth int
+	outer *txState
+}
+
+// sameDB reports whether a and b are the same database, values of uncomparable types never are
+func sameDB(a, b interface{}) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// txOf returns the transaction of db carried in ctx
+func txOf(ctx context.Context, db interface{}) (*txState, bool) {
+	state, _ := ctx.Value(cctx.CtxTx).(*txState)
+	for ; state != nil; state = state.outer {
+		if sameDB(state.db, db) {
+			return state, true
+		}
+	}
+	return nil, false
+}
+
+// TxFromContext returns the transaction of WithTx carried in ctx
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	state, ok := ctx.Value(cctx.CtxTx).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return state.tx, true
+}
+
+// Conn returns the transaction of db carried in ctx or db, repositories run every query on it to join the
+// transaction of their caller. db must be the value passed to WithTx, transactions of other databases are
+// not joined.
+func Conn(ctx context.Context, db Executor) Executor {
+	if state, ok := txOf(ctx, db); ok {
+		return state.tx
+	}
+	return db
+}
+
+// IsRetryable reports whether err is a deadlock or serialization failure, MySQL 1213 and 1205
+// or postgres 40001 and 40P01
+func IsRetryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDeadlock || mysqlErr.Number == mysqlLockWaitTimeout
+	}
+
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		state := pgErr.SQLState()
+		return state == pgSerializationFailure || state == pgDeadlockDetected
+	}
+	return false
+}
+
+// WithTx runs fn in a transaction of db, it commits when fn returns nil and rolls back when fn fails or panics.
+// The transaction is carried in the context passed to fn, see Conn. Deadlocks and serialization failures
+// rerun the whole fn with backoff, fn must not have side effects outside the transaction.
+// Nested calls on the same db with a context of WithTx run in a savepoint of the outer transaction, they are
+// rolled back to the savepoint on failure, are never retried on their own and ignore opts. Calls on another db
+// start their own transaction. opts may be nil.
+func WithTx(ctx context.Context, db Beginner, opts *TxOptions, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	if state, ok := txOf(ctx, db); ok {
+		return withSavepoint(ctx, state, fn)
+	}
+
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	policy := opts.Retry
+	if policy.MaxAttempts == 0 {
+		policy = retry.Policy{MaxAttempts: 3, Backoff: retry.DefaultBackoff}
+	}
+	txOpts := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, txOpts, fn)
+		if err == nil {
+			policy.Success()
+			return nil
+		}
+		if !IsRetryable(err) || !policy.Allow(attempt) {
+			return err
+		}
+
+		delay := policy.Delay(attempt, 0)
+		log.Printf("transaction aborted, attempt %d/%d, retrying in %s: %v", attempt, policy.MaxAttempts, delay, err)
+		if sleepErr := retry.Sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+func runTx(ctx context.Context, db Beginner, opts *sql.TxOptions, fn func(context.Context, *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	outer, _ := ctx.Value(cctx.CtxTx).(*txState)
+	if err := fn(context.WithValue(ctx, cctx.CtxTx, &txState{db: db, tx: tx, outer: outer}), tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Printf("transaction rollback failed: %v", rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func withSavepoint(ctx context.Context, state *txState, fn func(context.Context, *sql.Tx) error) error {
+	outer, _ := ctx.Value(cctx.CtxTx).(*txState)
+	nested := &txState{db: state.db, tx: state.tx, depth: state.depth + 1, outer: outer}
+	savepoint := fmt.Sprintf("sp_%d", nested.depth)
+
+	if _, err := state.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, cctx.CtxTx, nested), state.tx); err != nil {
+		if _, rbErr := state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rbErr != nil {
+			log.Printf("rollback to savepoint %s failed: %v", savepoint, rbErr)
+		}
+		return err
+	}
+
+	_, err := state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/budhip/common/retry"
+	"github.com/go-sql-driver/mysql"
+)
+
+// txDriver records transaction statements
+type txDriver struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (d *txDriver) record(statement string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, statement)
+}
+
+func (d *txDriver) statements() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := strings.Join(d.log, ",")
+	d.log = nil
+	return s
+}
+
+func (d *txDriver) Open(string) (driver.Conn, error) { return txConn{d: d}, nil }
+
+type txConn struct {
+	fakeConn
+	d *txDriver
+}
+
+func (c txConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.d.record("BEGIN")
+	return c, nil
+}
+
+func (c txConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.d.record(query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c txConn) Commit() error {
+	c.d.record("COMMIT")
+	return nil
+}
+
+func (c txConn) Rollback() error {
+	c.d.record("ROLLBACK")
+	return nil
+}
+
+type txConnector struct {
+	d *txDriver
+}
+
+func (c txConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c txConnector) Driver() driver.Driver                        { return c.d }
+
+func TestWithTx(t *testing.T) {
+	d := &txDriver{}
+	db := sql.OpenDB(txConnector{d: d})
+	defer db.Close()
+
+	ctx := context.Background()
+	opts := &TxOptions{Retry: retry.Policy{MaxAttempts: 3, Backoff: retry.Backoff{Initial: time.Millisecond}}}
+	errFailed := errors.New("failed")
+
+	err := WithTx(ctx, db, opts, func(ctx context.Context, tx *sql.Tx) error {
+		if conn := Conn(ctx, db); conn != tx {
+			t.Fatalf("repositories should join the transaction")
+		}
+		_, err := Conn(ctx, db).ExecContext(ctx, "INSERT")
+		return err
+	})
+	if got := d.statements(); err != nil || got != "BEGIN,INSERT,COMMIT" {
+		t.Fatalf("bad commit: %v %v", got, err)
+	}
+
+	err = WithTx(ctx, db, opts, func(ctx context.Context, tx *sql.Tx) error {
+		return errFailed
+	})
+	if got := d.statements(); err != errFailed || got != "BEGIN,ROLLBACK" {
+		t.Fatalf("bad rollback: %v %v", got, err)
+	}
+
+	attempts := 0
+	err = WithTx(ctx, db, opts, func(ctx context.Context, tx *sql.Tx) error {
+		if attempts++; attempts < 3 {
+			return &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+		}
+		return nil
+	})
+	if got := d.statements(); err != nil || got != "BEGIN,ROLLBACK,BEGIN,ROLLBACK,BEGIN,COMMIT" {
+		t.Fatalf("bad retry: %v %v", got, err)
+	}
+
+	err = WithTx(ctx, db, opts, func(ctx context.Context, tx *sql.Tx) error {
+		if err := WithTx(ctx, db, opts, func(ctx context.Context, tx *sql.Tx) error {
+			return errFailed
+		}); err != errFailed {
+			t.Fatalf("bad nested error: %v", err)
+		}
+		return WithTx(ctx, db, opts, func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		})
+	})
+	want := "BEGIN,SAVEPOINT sp_1,ROLLBACK TO SAVEPOINT sp_1,SAVEPOINT sp_1,RELEASE SAVEPOINT sp_1,COMMIT"
+	if got := d.statements(); err != nil || got != want {
+		t.Fatalf("bad savepoints: %v %v", got, err)
+	}
+
+	other := &txDriver{}
+	otherDB := sql.OpenDB(txConnector{d: other})
+	defer otherDB.Close()
+	logger := NewSlowQueryLogger("users", db, time.Hour)
+	err = WithTx(ctx, db, opts, func(ctx context.Context, tx *sql.Tx) error {
+		if Conn(ctx, otherDB) != otherDB {
+			t.Fatalf("queries of another database should not join the transaction")
+		}
+		return WithTx(ctx, otherDB, opts, func(ctx context.Context, otherTx *sql.Tx) error {
+			if otherTx == tx {
+				t.Fatalf("another database should not join the transaction")
+			}
+			if Conn(ctx, db) != tx || Conn(ctx, otherDB) != otherTx {
+				t.Fatalf("queries should join the transaction of their database")
+			}
+			_, err := logger.ExecContext(ctx, "INSERT")
+			return err
+		})
+	})
+	if got := d.statements() + "|" + other.statements(); err != nil || got != "BEGIN,INSERT,COMMIT|BEGIN,COMMIT" {
+		t.Fatalf("another database should start its own transaction: %v %v", got, err)
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("panic should be propagated: %v", p)
+			}
+		}()
+		_ = WithTx(ctx, db, opts, func(ctx context.Context, tx *sql.Tx) error {
+			panic("boom")
+		})
+	}()
+	if got := d.statements(); got != "BEGIN,ROLLBACK" {
+		t.Fatalf("bad rollback on panic: %v", got)
+	}
+}
@@ -0,0 +1,108 @@
+// Package database holds driver independent helpers for the mysql and postgre packages.
+//
+// Cluster reads from replicas, which lag behind the primary. Reads never stick to the primary after a write, code
+// reading its own writes must route the reads to the primary with WithPrimary or run them in the transaction of
+// the write, see WithTx and Conn.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/budhip/common/retry"
+)
+
+var (
+	// ErrAuth is returned when the database rejects the credentials
+	ErrAuth = errors.New("database: authentication failed")
+	// ErrUnreachable is returned when the database cannot be reached or is still starting up
+	ErrUnreachable = errors.New("database: unreachable")
+	// ErrUnknownDatabase is returned when the database name does not exist
+	ErrUnknownDatabase = errors.New("database: unknown database")
+)
+
+// ConnectError is a connection failure of kind ErrAuth, ErrUnreachable or ErrUnknownDatabase,
+// errors.Is matches its kind and errors.As the driver error
+type ConnectError struct {
+	Kind error
+	Err  error
+}
+
+func (e *ConnectError) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the driver error
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of the error
+func (e *ConnectError) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Classifier returns the kind of a driver error, ErrAuth, ErrUnreachable or ErrUnknownDatabase, or nil
+type Classifier func(err error) error
+
+// IsNetworkError reports whether err is a network failure or timeout
+func IsNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn)
+}
+
+// VerifyOptions configures Verify
+type VerifyOptions struct {
+	// Timeout of every ping, defaults to 5s
+	Timeout time.Duration
+	// Attempts is the maximum number of pings, values below 2 disable retry
+	Attempts int
+	// Backoff between pings, defaults to retry.DefaultBackoff
+	Backoff retry.Backoff
+}
+
+// Verify pings db and retries unreachable errors with backoff, e.g. while the database container starts.
+// Errors are classified into ConnectError, authentication and unknown database failures are not retried.
+func Verify(ctx context.Context, db *sql.DB, opts VerifyOptions, classify Classifier) error {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Backoff == (retry.Backoff{}) {
+		opts.Backoff = retry.DefaultBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := ping(ctx, db, opts.Timeout)
+		if err == nil {
+			return nil
+		}
+
+		kind := classify(err)
+		if kind == nil && IsNetworkError(err) {
+			kind = ErrUnreachable
+		}
+		if kind != nil {
+			err = &ConnectError{Kind: kind, Err: err}
+		}
+		if kind != ErrUnreachable || attempt >= opts.Attempts {
+			return err
+		}
+
+		delay := opts.Backoff.Duration(attempt)
+		log.Printf("database ping failed, attempt %d/%d, retrying in %s: %v", attempt, opts.Attempts, delay, err)
+		if err := retry.Sleep(ctx, delay); err != nil {
+			return &ConnectError{Kind: ErrUnreachable, Err: err}
+		}
+	}
+}
+
+func ping(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
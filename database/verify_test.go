@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/budhip/common/retry"
+)
+
+var (
+	errAuth    = errors.New("access denied")
+	errRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+)
+
+// fakeDriver fails to open connections with the queued errors, then succeeds
+type fakeDriver struct {
+	mu    sync.Mutex
+	errs  []error
+	opens int
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.opens++
+	if len(d.errs) > 0 {
+		err := d.errs[0]
+		d.errs = d.errs[1:]
+		return nil, err
+	}
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not implemented") }
+
+type connector struct {
+	d *fakeDriver
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.d }
+
+func classify(err error) error {
+	if errors.Is(err, errAuth) {
+		return ErrAuth
+	}
+	return nil
+}
+
+func TestVerify(t *testing.T) {
+	opts := VerifyOptions{Timeout: time.Second, Attempts: 3, Backoff: retry.Backoff{Initial: time.Millisecond}}
+
+	tests := []struct {
+		errs  []error
+		kind  error
+		opens int
+	}{
+		{errs: nil, kind: nil, opens: 1},
+		{errs: []error{errRefused, errRefused}, kind: nil, opens: 3},
+		{errs: []error{errRefused, errRefused, errRefused}, kind: ErrUnreachable, opens: 3},
+		{errs: []error{errAuth}, kind: ErrAuth, opens: 1},
+	}
+
+	for i, tt := range tests {
+		d := &fakeDriver{errs: tt.errs}
+		db := sql.OpenDB(connector{d: d})
+
+		err := Verify(context.Background(), db, opts, classify)
+		if tt.kind == nil && err != nil || tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Fatalf("bad error of test %d: %v", i, err)
+		}
+		if d.opens != tt.opens {
+			t.Fatalf("bad attempts of test %d: %v", i, d.opens)
+		}
+		db.Close()
+	}
+}
@@ -1,14 +1,34 @@
 package error
 
-import "google.golang.org/grpc/codes"
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// FieldViolation describes a single invalid field of a request
+type FieldViolation struct {
+	Field       string
+	Description string
+}
 
 type ServiceError struct {
 	Status     codes.Code
 	Code       string
 	Message    string
 	Attributes map[string]string
+
+	// Domain is the logical grouping of Code, e.g. the service name
+	Domain string
+	// Locale and LocalizedMessage hold a message that is safe to show to the end user
+	Locale           string
+	LocalizedMessage string
+	// FieldViolations lists the invalid fields of a bad request
+	FieldViolations []FieldViolation
+	// RetryAfter hints the client how long to wait before retrying, zero means no hint
+	RetryAfter time.Duration
 }
 
 func (e ServiceError) Error() string {
 	return e.Message
-}
\ No newline at end of file
+}
@@ -1,14 +1,18 @@
 module github.com/budhip/common
 
-go 1.14
+go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/golang/protobuf v1.4.3
 	github.com/gorilla/handlers v1.5.1
-	github.com/grpc-ecosystem/go-grpc-middleware v1.3.0
+	github.com/jackc/pgconn v1.13.0
+	github.com/jackc/pgx/v4 v4.17.2
 	github.com/mitchellh/mapstructure v1.4.3
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
 	google.golang.org/grpc v1.44.0
 	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/budhip/common/breaker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// breakerFailure reports whether err counts as a failure of the dependency, caller errors do not
+func breakerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+func breakerKey(cc *grpc.ClientConn, method string, perMethod bool) string {
+	if perMethod {
+		return method
+	}
+	if cc == nil {
+		return ""
+	}
+	return cc.Target()
+}
+
+// UnaryCircuitBreakerClientInterceptor returns a new unary client interceptor that fails fast with Unavailable
+// while the circuit breaker of the target, or of the method when perMethod is true, is open
+func UnaryCircuitBreakerClientInterceptor(breakers *breaker.Group, perMethod bool) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done, err := breakers.Get(breakerKey(cc, method, perMethod)).Allow()
+		if err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(breakerFailure(err))
+		return err
+	}
+}
+
+// StreamCircuitBreakerClientInterceptor returns a new stream client interceptor that fails fast with Unavailable
+// while the circuit breaker is open, only the stream creation counts as the call outcome
+func StreamCircuitBreakerClientInterceptor(breakers *breaker.Group, perMethod bool) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		done, err := breakers.Get(breakerKey(cc, method, perMethod)).Allow()
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		done(breakerFailure(err))
+		return stream, err
+	}
+}
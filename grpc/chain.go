@@ -0,0 +1,155 @@
+package grpc
+
+import (
+	"google.golang.org/grpc"
+)
+
+// Stage is a step of the server interceptor chain, stages run in the order they are declared
+type Stage int
+
+const (
+	// StageRecovery recovers from panic, it runs first so it covers every other stage
+	StageRecovery Stage = iota
+	// StageTracing starts the server span. It is a user-only stage without built-in interceptor, add one of the
+	// tracing library of the service with ReplaceStage.
+	StageTracing
+	// StageLogging logs every call with its status code and duration
+	StageLogging
+	// StageMetrics counts every call by method and status code
+	StageMetrics
+	// StageLoadShedding sheds calls over the concurrency limit, see UnaryLoadSheddingInterceptor
+	StageLoadShedding
+	// StageDeadline applies default and maximum timeouts, see UnaryDeadlineInterceptor
+	StageDeadline
+	// StageErrorMapping converts service and mapped errors into gRPC status with details
+	StageErrorMapping
+	// StageAuth extracts user info into context
+	StageAuth
+	// StageIdentity extracts the mutual TLS service identity into context, see UnaryIdentityInterceptor
+	StageIdentity
+	// StageRateLimit rejects calls over their limit, see UnaryRateLimitInterceptor
+	StageRateLimit
+	// StageMaintenance rejects calls under maintenance. It is a user-only stage, MaintenanceInterceptor needs the
+	// config of the service so add it with ReplaceStage.
+	StageMaintenance
+	// StageValidation validates incoming request
+	StageValidation
+
+	stageCount
+)
+
+type stage struct {
+	enabled bool
+	unary   []grpc.UnaryServerInterceptor
+	stream  []grpc.StreamServerInterceptor
+}
+
+// newStage returns stage of the given interceptors, a nil interceptor skips the stage for that kind of call
+func newStage(enabled bool, unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) stage {
+	s := stage{enabled: enabled}
+	s.add(unary, stream)
+	return s
+}
+
+func (s *stage) add(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) {
+	if unary != nil {
+		s.unary = append(s.unary, unary)
+	}
+	if stream != nil {
+		s.stream = append(s.stream, stream)
+	}
+}
+
+// Chain builds unary and stream server interceptors in a well-defined order
+type Chain struct {
+	stages [stageCount]stage
+}
+
+// ChainOption configures a Chain
+type ChainOption func(*Chain)
+
+// EnableStage enables stage with its current interceptors
+func EnableStage(s Stage) ChainOption {
+	return func(c *Chain) {
+		c.stages[s].enabled = true
+	}
+}
+
+// DisableStage disables stage
+func DisableStage(s Stage) ChainOption {
+	return func(c *Chain) {
+		c.stages[s].enabled = false
+	}
+}
+
+// ReplaceStage enables stage with the given interceptors, a nil interceptor skips the stage for that kind of call
+func ReplaceStage(s Stage, unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) ChainOption {
+	return func(c *Chain) {
+		c.stages[s] = newStage(true, unary, stream)
+	}
+}
+
+// AppendStage enables stage and adds the given interceptors after its current ones, interceptors of a stage run
+// in the order they are added. A nil interceptor is skipped.
+func AppendStage(s Stage, unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) ChainOption {
+	return func(c *Chain) {
+		c.stages[s].enabled = true
+		c.stages[s].add(unary, stream)
+	}
+}
+
+// NewChain returns chain with recovery, error mapping, auth and validation enabled.
+// Logging, metrics and identity have built-in interceptors but are disabled by default. Tracing, maintenance and
+// the stages of interceptors with required parameters, such as load shedding, deadline and rate limit, are empty
+// until ReplaceStage or AppendStage adds their interceptors.
+func NewChain(opts ...ChainOption) *Chain {
+	c := &Chain{}
+	c.stages[StageRecovery] = newStage(true, UnaryRecoveryInterceptor(), StreamRecoveryInterceptor())
+	c.stages[StageLogging] = newStage(false, UnaryLoggingInterceptor(), StreamLoggingInterceptor())
+	c.stages[StageMetrics] = newStage(false, UnaryMetricsInterceptor(), StreamMetricsInterceptor())
+	c.stages[StageErrorMapping] = newStage(true, UnaryErrorInterceptor(), StreamErrorInterceptor())
+	c.stages[StageAuth] = newStage(true, UnaryAuthInterceptor(), StreamAuthInterceptor())
+	c.stages[StageIdentity] = newStage(false, UnaryIdentityInterceptor(nil), StreamIdentityInterceptor(nil))
+	c.stages[StageValidation] = newStage(true, UnaryValidationInterceptor(true), StreamValidationInterceptor(true))
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Unary returns the enabled unary interceptors in stage order
+func (c *Chain) Unary() []grpc.UnaryServerInterceptor {
+	var interceptors []grpc.UnaryServerInterceptor
+	for _, s := range c.stages {
+		if s.enabled {
+			interceptors = append(interceptors, s.unary...)
+		}
+	}
+	return interceptors
+}
+
+// Stream returns the enabled stream interceptors in stage order
+func (c *Chain) Stream() []grpc.StreamServerInterceptor {
+	var interceptors []grpc.StreamServerInterceptor
+	for _, s := range c.stages {
+		if s.enabled {
+			interceptors = append(interceptors, s.stream...)
+		}
+	}
+	return interceptors
+}
+
+// ServerOptions returns gRPC server options with both interceptor chains
+func (c *Chain) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(c.Unary()...),
+		grpc.ChainStreamInterceptor(c.Stream()...),
+	}
+}
+
+// WithChain returns gRPC server options with interceptor chain built from opts
+func WithChain(opts ...ChainOption) []grpc.ServerOption {
+	return NewChain(opts...).ServerOptions()
+}
@@ -0,0 +1,102 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return handler(ctx, req)
+		}
+	}
+
+	chain := NewChain(
+		ReplaceStage(StageValidation, record("validation"), nil),
+		ReplaceStage(StageRateLimit, record("ratelimit"), nil),
+		ReplaceStage(StageRecovery, record("recovery"), nil),
+		DisableStage(StageAuth),
+	)
+
+	unary := chain.Unary()
+	if len(unary) != 4 {
+		t.Fatalf("bad unary chain length: %v", len(unary))
+	}
+	if stream := chain.Stream(); len(stream) != 1 {
+		t.Fatalf("bad stream chain length: %v", len(stream))
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	for i := len(unary) - 1; i >= 0; i-- {
+		interceptor, next := unary[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{}, next)
+		}
+	}
+	if _, err := handler(context.Background(), nil); err != nil {
+		t.Fatalf("bad chain: %v", err)
+	}
+
+	if got := strings.Join(calls, ","); got != "recovery,ratelimit,validation" {
+		t.Fatalf("bad chain order: %v", got)
+	}
+}
+
+func TestChainStageOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return handler(ctx, req)
+		}
+	}
+
+	chain := NewChain(
+		DisableStage(StageRecovery),
+		DisableStage(StageErrorMapping),
+		DisableStage(StageAuth),
+		DisableStage(StageValidation),
+		AppendStage(StageRateLimit, record("ratelimit-user"), nil),
+		AppendStage(StageTracing, record("tracing"), nil),
+		AppendStage(StageRateLimit, record("ratelimit-ip"), nil),
+		AppendStage(StageRateLimit, nil, nil),
+	)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	unary := chain.Unary()
+	for i := len(unary) - 1; i >= 0; i-- {
+		interceptor, next := unary[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{}, next)
+		}
+	}
+	if _, err := handler(context.Background(), nil); err != nil {
+		t.Fatalf("bad chain: %v", err)
+	}
+
+	if got := strings.Join(calls, ","); got != "tracing,ratelimit-user,ratelimit-ip" {
+		t.Fatalf("interceptors of a stage should run in the order they are added: %v", got)
+	}
+}
+
+func TestCombineServerOptions(t *testing.T) {
+	var opts []grpc.ServerOption
+	opts = append(opts, WithRecovery()...)
+	opts = append(opts, WithValidation()...)
+	opts = append(opts, WithErrorDetails()...)
+
+	server := grpc.NewServer(opts...)
+	server.Stop()
+}
@@ -0,0 +1,158 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	svcerr "github.com/budhip/common/error"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Deadline is the timeout policy of a method, zero value means no default or no maximum
+type Deadline struct {
+	// Default is applied to calls that arrive without deadline
+	Default time.Duration
+	// Max caps the deadline sent by the caller and Default, calls without deadline get Max when Default is not set
+	Max time.Duration
+}
+
+// DeadlineConfig configures the server deadline interceptor
+type DeadlineConfig struct {
+	// Default is the policy of methods that are not in Methods
+	Default Deadline
+	// Methods holds the policy by full method
+	Methods map[string]Deadline
+	// Margin is reserved for sending the response, the handler deadline is shortened by it
+	Margin time.Duration
+	// MinBudget rejects calls whose remaining time is already below it
+	MinBudget time.Duration
+}
+
+func (c DeadlineConfig) policy(fullMethod string) Deadline {
+	if d, ok := c.Methods[fullMethod]; ok {
+		return d
+	}
+	return c.Default
+}
+
+// withDeadline returns context with the handler budget of fullMethod, or error when the budget is too small
+func (c DeadlineConfig) withDeadline(ctx context.Context, fullMethod string) (context.Context, context.CancelFunc, error) {
+	policy := c.policy(fullMethod)
+
+	var budget time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		budget = time.Until(deadline)
+	} else if policy.Default > 0 {
+		budget = policy.Default
+	} else if policy.Max > 0 {
+		budget = policy.Max
+	} else {
+		return ctx, func() {}, nil
+	}
+	if policy.Max > 0 && budget > policy.Max {
+		budget = policy.Max
+	}
+
+	budget -= c.Margin
+	if budget <= 0 || budget < c.MinBudget {
+		return ctx, func() {}, grpcError(svcerr.ServiceError{
+			Status:  codes.DeadlineExceeded,
+			Code:    codeName(codes.DeadlineExceeded),
+			Message: "not enough time left to process the request",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	return ctx, cancel, nil
+}
+
+// UnaryDeadlineInterceptor returns a new unary server interceptor that applies per method default and
+// maximum timeouts, keeps a margin for the response and rejects calls with too little time left
+func UnaryDeadlineInterceptor(config DeadlineConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel, err := config.withDeadline(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer cancel()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamDeadlineInterceptor returns a new streaming server interceptor that applies per method default and
+// maximum timeouts, keeps a margin for the response and rejects calls with too little time left
+func StreamDeadlineInterceptor(config DeadlineConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel, err := config.withDeadline(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// outgoingDeadline returns context whose deadline is the remaining deadline minus margin,
+// or defaultTimeout when ctx has no deadline
+func outgoingDeadline(ctx context.Context, defaultTimeout, margin time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if margin <= 0 {
+			return ctx, func() {}
+		}
+		return context.WithDeadline(ctx, deadline.Add(-margin))
+	}
+	if defaultTimeout > 0 {
+		return context.WithTimeout(ctx, defaultTimeout)
+	}
+	return ctx, func() {}
+}
+
+// UnaryDeadlineClientInterceptor returns a new unary client interceptor that passes the remaining deadline,
+// minus margin kept to handle the response, to downstream calls. Calls without deadline get defaultTimeout.
+func UnaryDeadlineClientInterceptor(defaultTimeout, margin time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := outgoingDeadline(ctx, defaultTimeout, margin)
+		defer cancel()
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamDeadlineClientInterceptor returns a new stream client interceptor that passes the remaining deadline,
+// minus margin, to downstream calls. Calls without deadline are left as is since streams may be long-lived.
+func StreamDeadlineClientInterceptor(margin time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if _, ok := ctx.Deadline(); !ok || margin <= 0 {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		ctx, cancel := outgoingDeadline(ctx, 0, margin)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		return &clientStream{ClientStream: stream, cancel: cancel}, nil
+	}
+}
+
+// clientStream cancels its context once the stream is finished
+type clientStream struct {
+	grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.cancel()
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryDeadlineInterceptor(t *testing.T) {
+	config := DeadlineConfig{
+		Default: Deadline{Default: time.Second, Max: 2 * time.Second},
+		Methods: map[string]Deadline{
+			"/user.User/Export": {Default: time.Minute},
+			"/user.User/Search": {Max: 3 * time.Second},
+			"/user.User/List":   {Default: time.Minute, Max: 5 * time.Second},
+		},
+		Margin:    100 * time.Millisecond,
+		MinBudget: 50 * time.Millisecond,
+	}
+
+	var budget time.Duration
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatalf("handler has no deadline")
+		}
+		budget = time.Until(deadline)
+		return nil, nil
+	}
+
+	tests := []struct {
+		method  string
+		timeout time.Duration
+		max     time.Duration
+		code    codes.Code
+	}{
+		{method: "/user.User/Get", max: 900 * time.Millisecond},
+		{method: "/user.User/Get", timeout: time.Minute, max: 1900 * time.Millisecond},
+		{method: "/user.User/Export", max: time.Minute},
+		{method: "/user.User/Search", max: 2900 * time.Millisecond},
+		{method: "/user.User/List", max: 4900 * time.Millisecond},
+		{method: "/user.User/Get", timeout: 120 * time.Millisecond, code: codes.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+			defer cancel()
+		}
+
+		budget = 0
+		_, err := UnaryDeadlineInterceptor(config)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+		if status.Code(err) != tt.code {
+			t.Fatalf("bad status: %v", err)
+		}
+		if tt.code == codes.OK && (budget > tt.max || budget < tt.max-time.Second) {
+			t.Fatalf("bad budget for %v: %v", tt.method, budget)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package grpc
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	cctx "github.com/budhip/common/context"
+	svcerr "github.com/budhip/common/error"
+	"github.com/budhip/common/idempotency"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// UnaryIdempotencyInterceptor returns a new unary server interceptor for calls with idempotency-key metadata.
+// The key is scoped by cID and method, calls without cID are rejected with Unauthenticated so use
+// UnaryAuthInterceptor before it. The first successful response is stored for ttl and replayed to duplicate calls
+// with the same request, a different request fails with InvalidArgument. Duplicates of a call still in progress
+// fail with Aborted for up to idempotency.Lease. Failed calls release the key.
+func UnaryIdempotencyInterceptor(store idempotency.Store, ttl time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(strings.ToLower(idempotency.Header))
+		if len(values) == 0 || len(values[0]) == 0 {
+			return handler(ctx, req)
+		}
+
+		cID := cctx.GetContextAsString(ctx, cctx.CtxCID)
+		if len(cID) == 0 {
+			// keys of anonymous callers would be shared by every one of them
+			return nil, grpcError(svcerr.ServiceError{
+				Status:  codes.Unauthenticated,
+				Code:    codeName(codes.Unauthenticated),
+				Message: "idempotency key requires an authenticated caller",
+			})
+		}
+		fingerprint, err := requestFingerprint(req)
+		if err != nil {
+			return nil, err
+		}
+
+		key := idempotency.Key(cID, info.FullMethod, values[0])
+		record, ok, err := store.Begin(ctx, key, fingerprint, idempotency.LeaseFor(ttl))
+		if err != nil {
+			log.Printf("idempotency store error: %v", err)
+			return nil, grpcError(svcerr.ServiceError{
+				Status:  codes.Unavailable,
+				Code:    codeName(codes.Unavailable),
+				Message: "idempotency store is unavailable",
+			})
+		}
+		if !ok {
+			if record.Fingerprint != fingerprint {
+				return nil, grpcError(svcerr.ServiceError{
+					Status:  codes.InvalidArgument,
+					Code:    codeName(codes.InvalidArgument),
+					Message: idempotency.ErrMismatch.Error(),
+				})
+			}
+			return replay(record)
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			if releaseErr := store.Release(ctx, key); releaseErr != nil {
+				log.Printf("idempotency store error: %v", releaseErr)
+			}
+			return nil, err
+		}
+
+		if err := complete(ctx, store, key, resp, ttl); err != nil {
+			log.Printf("idempotency store error: %v", err)
+		}
+		return resp, nil
+	}
+}
+
+// requestFingerprint returns the fingerprint of the deterministic encoding of req, empty for non proto requests
+func requestFingerprint(req interface{}) (string, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return "", nil
+	}
+	request, err := protov2.MarshalOptions{Deterministic: true}.Marshal(proto.MessageV2(msg))
+	if err != nil {
+		return "", err
+	}
+	return idempotency.Fingerprint(request), nil
+}
+
+func replay(record idempotency.Record) (interface{}, error) {
+	if !record.Completed {
+		return nil, grpcError(svcerr.ServiceError{
+			Status:  codes.Aborted,
+			Code:    codeName(codes.Aborted),
+			Message: idempotency.ErrInFlight.Error(),
+		})
+	}
+
+	var stored anypb.Any
+	if err := proto.Unmarshal(record.Response, &stored); err != nil {
+		return nil, err
+	}
+	resp, err := stored.UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func complete(ctx context.Context, store idempotency.Store, key string, resp interface{}, ttl time.Duration) error {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return store.Release(ctx, key)
+	}
+
+	stored, err := anypb.New(proto.MessageV2(msg))
+	if err != nil {
+		return err
+	}
+	response, err := proto.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return store.Complete(ctx, key, response, ttl)
+}
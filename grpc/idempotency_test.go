@@ -0,0 +1,63 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cctx "github.com/budhip/common/context"
+	"github.com/budhip/common/idempotency"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestUnaryIdempotencyInterceptor(t *testing.T) {
+	store := idempotency.NewMemoryStore()
+	interceptor := UnaryIdempotencyInterceptor(store, time.Minute)
+	info := &grpc.UnaryServerInfo{FullMethod: "/payment.Payment/Pay"}
+	user := context.WithValue(context.Background(), cctx.CtxCID, "cid-1")
+	ctx := metadata.NewIncomingContext(user, metadata.Pairs("idempotency-key", "abc"))
+	req := wrapperspb.String("pay 100")
+
+	var calls int
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		return wrapperspb.String("paid"), nil
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := interceptor(ctx, req, info, handler)
+		if err != nil {
+			t.Fatalf("bad call: %v", err)
+		}
+		if got := resp.(*wrapperspb.StringValue).GetValue(); got != "paid" {
+			t.Fatalf("bad response: %v", got)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("duplicate call should be replayed: %v calls", calls)
+	}
+
+	if _, err := interceptor(ctx, wrapperspb.String("pay 200"), info, handler); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("key reused with a different request should be rejected: %v", err)
+	}
+
+	inFlightCtx := metadata.NewIncomingContext(user, metadata.Pairs("idempotency-key", "def"))
+	_, err := interceptor(inFlightCtx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return interceptor(inFlightCtx, req, info, handler)
+	})
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("duplicate of call in progress should be aborted: %v", err)
+	}
+
+	anonymous := metadata.NewIncomingContext(context.Background(), metadata.Pairs("idempotency-key", "abc"))
+	if _, err := interceptor(anonymous, req, info, handler); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("anonymous call with a key should be rejected: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("rejected calls should not reach the handler: %v calls", calls)
+	}
+}
@@ -0,0 +1,57 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/budhip/common/auth"
+	svcerr "github.com/budhip/common/error"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// authorizeIdentity extracts the mutual TLS peer identity into context and checks it against policy,
+// calls without verified client certificate are rejected with Unauthenticated on restricted methods
+func authorizeIdentity(ctx context.Context, fullMethod string, policy auth.IdentityPolicy) (context.Context, error) {
+	ctx = auth.WithPeerIdentityContext(ctx)
+	if policy.Allow(ctx, fullMethod) {
+		return ctx, nil
+	}
+
+	code, message := codes.PermissionDenied, "service identity is not allowed"
+	if _, ok := auth.ServiceIdentityFromContext(ctx); !ok {
+		code, message = codes.Unauthenticated, "client certificate is required"
+	}
+	return ctx, grpcError(svcerr.ServiceError{
+		Status:  code,
+		Code:    codeName(code),
+		Message: message,
+	})
+}
+
+// UnaryIdentityInterceptor returns a new unary server interceptor that extracts the service identity
+// of the client certificate into context, see auth.ServiceIdentityFromContext. A nil policy allows every call.
+func UnaryIdentityInterceptor(policy auth.IdentityPolicy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorizeIdentity(ctx, info.FullMethod, policy)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamIdentityInterceptor returns a new streaming server interceptor that extracts the service identity
+// of the client certificate into context, see auth.ServiceIdentityFromContext. A nil policy allows every call.
+func StreamIdentityInterceptor(policy auth.IdentityPolicy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorizeIdentity(stream.Context(), info.FullMethod, policy)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
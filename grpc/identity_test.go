@@ -0,0 +1,138 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/budhip/common/auth"
+	ctls "github.com/budhip/common/tls"
+	"github.com/budhip/common/tls/tlstest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func peerContext(cert *x509.Certificate) context.Context {
+	state := tls.ConnectionState{}
+	if cert != nil {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestUnaryIdentityInterceptor(t *testing.T) {
+	spiffeID, _ := url.Parse("spiffe://example.org/ns/payment/sa/ledger")
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "ledger"},
+		URIs:     []*url.URL{spiffeID},
+		DNSNames: []string{"ledger.payment.svc"},
+	}
+
+	policy := auth.IdentityPolicy{
+		"/payment.Ledger/*":        {"spiffe://example.org/ns/payment/*"},
+		"/payment.Admin/Reconcile": {"reconciler"},
+	}
+
+	var identity auth.ServiceIdentity
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity, _ = auth.ServiceIdentityFromContext(ctx)
+		return nil, nil
+	}
+
+	tests := []struct {
+		ctx    context.Context
+		method string
+		code   codes.Code
+	}{
+		{ctx: context.Background(), method: "/payment.Public/Get", code: codes.OK},
+		{ctx: peerContext(cert), method: "/payment.Admin/Reconcile", code: codes.PermissionDenied},
+		{ctx: peerContext(nil), method: "/payment.Ledger/Post", code: codes.Unauthenticated},
+		{ctx: peerContext(cert), method: "/payment.Ledger/Post", code: codes.OK},
+	}
+
+	for _, tt := range tests {
+		_, err := UnaryIdentityInterceptor(policy)(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+		if got := status.Code(err); got != tt.code {
+			t.Fatalf("bad status for %s: %v", tt.method, got)
+		}
+	}
+
+	if identity.SPIFFEID != spiffeID.String() || identity.CommonName != "ledger" || len(identity.DNSNames) != 1 {
+		t.Fatalf("bad identity: %+v", identity)
+	}
+}
+
+func TestSecureSourceIdentity(t *testing.T) {
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := ca.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := ca.Client(tlstest.WithURIs("spiffe://example.org/ns/payment/sa/ledger"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	caFile := write("ca.crt", ca.CertPEM)
+	serverSource, err := ctls.NewSource(write("server.crt", serverCert.CertPEM), write("server.key", serverCert.KeyPEM),
+		caFile, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSource, err := ctls.NewSource(write("client.crt", clientCert.CertPEM), write("client.key", clientCert.KeyPEM),
+		caFile, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var identity auth.ServiceIdentity
+	record := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		identity, _ = auth.ServiceIdentityFromContext(ctx)
+		return handler(ctx, req)
+	}
+	server := grpc.NewServer(WithSecureSource(serverSource, true),
+		grpc.ChainUnaryInterceptor(UnaryIdentityInterceptor(nil), record))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), DialSecureSource(clientSource, "localhost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("bad call: %v", err)
+	}
+	if !identity.Matches("spiffe://example.org/ns/payment/*") {
+		t.Fatalf("identity of the client certificate should be in context, got %+v", identity)
+	}
+}
@@ -3,33 +3,36 @@ package grpc
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/budhip/common/auth"
 	svcerr "github.com/budhip/common/error"
 	rc "github.com/budhip/common/remoteconfig"
 	"github.com/budhip/common/tls"
-	recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
-	validator "github.com/grpc-ecosystem/go-grpc-middleware/validator"
+	"github.com/golang/protobuf/proto"
 	"github.com/mitchellh/mapstructure"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/jwt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const (
 	errorCode    = "error_code"
 	errorMessage = "error_message"
+	retryAfter   = "retry_after"
 )
 
 func errorMetadata(serviceError svcerr.ServiceError) metadata.MD {
@@ -41,17 +44,60 @@ func errorMetadata(serviceError svcerr.ServiceError) metadata.MD {
 			data[k] = v
 		}
 	}
+	if serviceError.RetryAfter > 0 {
+		data[retryAfter] = strconv.FormatInt(int64(serviceError.RetryAfter/time.Millisecond), 10)
+	}
 	return metadata.New(data)
 }
 
+// errorDetails returns the google.rpc standard error details of service error
+func errorDetails(serviceError svcerr.ServiceError) []proto.Message {
+	details := []proto.Message{
+		&errdetails.ErrorInfo{
+			Reason:   serviceError.Code,
+			Domain:   serviceError.Domain,
+			Metadata: serviceError.Attributes,
+		},
+	}
+
+	if len(serviceError.FieldViolations) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, v := range serviceError.FieldViolations {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		details = append(details, badRequest)
+	}
+
+	if serviceError.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{
+			RetryDelay: durationpb.New(serviceError.RetryAfter),
+		})
+	}
+
+	if len(serviceError.LocalizedMessage) > 0 {
+		details = append(details, &errdetails.LocalizedMessage{
+			Locale:  serviceError.Locale,
+			Message: serviceError.LocalizedMessage,
+		})
+	}
+
+	return details
+}
+
 func grpcError(serviceError svcerr.ServiceError) error {
 	pbError := Error{
 		Code:       serviceError.Code,
 		Message:    serviceError.Message,
 		Attributes: serviceError.Attributes,
 	}
+	details := []proto.Message{&pbError}
+	details = append(details, errorDetails(serviceError)...)
+
 	grpcError := status.New(serviceError.Status, serviceError.Message)
-	errWithDetails, err := grpcError.WithDetails(&pbError)
+	errWithDetails, err := grpcError.WithDetails(details...)
 	if err != nil {
 		return grpcError.Err()
 	}
@@ -59,13 +105,16 @@ func grpcError(serviceError svcerr.ServiceError) error {
 }
 
 // UnaryErrorInterceptor returns a new unary server interceptor that added error detail for service error.
-func UnaryErrorInterceptor() grpc.UnaryServerInterceptor {
+// Errors that are not service error are converted by mappers, DefaultErrorMappers is used when none is given.
+func UnaryErrorInterceptor(mappers ...ErrorMapper) grpc.UnaryServerInterceptor {
+	if len(mappers) == 0 {
+		mappers = DefaultErrorMappers()
+	}
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler) (interface{}, error) {
 		resp, err := handler(ctx, req)
 		if err != nil {
-			var serviceError svcerr.ServiceError
-			if ok := errors.As(err, &serviceError); ok {
+			if serviceError, ok := mapError(err, mappers); ok {
 				md := errorMetadata(serviceError)
 				if err := grpc.SetTrailer(ctx, md); err != nil {
 					log.Print(err)
@@ -82,13 +131,16 @@ func UnaryErrorInterceptor() grpc.UnaryServerInterceptor {
 }
 
 // StreamErrorInterceptor returns a new streaming server interceptor that added error detail for service error.
-func StreamErrorInterceptor() grpc.StreamServerInterceptor {
+// Errors that are not service error are converted by mappers, DefaultErrorMappers is used when none is given.
+func StreamErrorInterceptor(mappers ...ErrorMapper) grpc.StreamServerInterceptor {
+	if len(mappers) == 0 {
+		mappers = DefaultErrorMappers()
+	}
 	return func(srv interface{}, stream grpc.ServerStream,
 		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		err := handler(srv, stream)
 		if err != nil {
-			var serviceError svcerr.ServiceError
-			if ok := errors.As(err, &serviceError); ok {
+			if serviceError, ok := mapError(err, mappers); ok {
 				return grpcError(serviceError)
 			}
 
@@ -109,17 +161,23 @@ func UnaryAuthInterceptor() grpc.UnaryServerInterceptor {
 	}
 }
 
-func UnaryRecoveryInterceptor() grpc.UnaryServerInterceptor {
-	handler := func(p interface{}) (err error) {
-		log.Print("panic", p)
-		return status.Error(codes.Internal, "server panic")
+// StreamAuthInterceptor returns a new streaming server interceptor that extract user info from token.
+func StreamAuthInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := auth.WithUserInfoContext(stream.Context())
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
 	}
+}
 
-	opts := []recovery.Option{
-		recovery.WithRecoveryHandler(handler),
-	}
+// serverStream overrides the context of the wrapped stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
 
-	return recovery.UnaryServerInterceptor(opts...)
+func (s *serverStream) Context() context.Context {
+	return s.ctx
 }
 
 func UnaryMaintenanceInterceptor(firebaseClientEmail, firebaseClientPrivatekey string,
@@ -176,38 +234,11 @@ func UnaryMaintenanceInterceptor(firebaseClientEmail, firebaseClientPrivatekey s
 	}
 }
 
-func StreamRecoveryInterceptor() grpc.StreamServerInterceptor {
-	handler := func(p interface{}) (err error) {
-		log.Print("panic", p)
-		return status.Error(codes.Internal, "server panic")
-	}
-
-	opts := []recovery.Option{
-		recovery.WithRecoveryHandler(handler),
-	}
-
-	return recovery.StreamServerInterceptor(opts...)
-}
-
-func recoveryInterceptor() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
-	handler := func(p interface{}) (err error) {
-		log.Print("panic", p)
-		return status.Error(codes.Internal, "server panic")
-	}
-
-	opts := []recovery.Option{
-		recovery.WithRecoveryHandler(handler),
-	}
-
-	return recovery.UnaryServerInterceptor(opts...), recovery.StreamServerInterceptor(opts...)
-}
-
 // WithRecovery return gRPC server options with recovery handler
 func WithRecovery() []grpc.ServerOption {
-	unary, stream := recoveryInterceptor()
 	serverOptions := []grpc.ServerOption{
-		grpc.UnaryInterceptor(unary),
-		grpc.StreamInterceptor(stream),
+		grpc.ChainUnaryInterceptor(UnaryRecoveryInterceptor()),
+		grpc.ChainStreamInterceptor(StreamRecoveryInterceptor()),
 	}
 	return serverOptions
 }
@@ -215,8 +246,8 @@ func WithRecovery() []grpc.ServerOption {
 // WithValidation returns gRPC server options with request validator
 func WithValidation() []grpc.ServerOption {
 	serverOptions := []grpc.ServerOption{
-		grpc.UnaryInterceptor(validator.UnaryServerInterceptor()),
-		grpc.StreamInterceptor(validator.StreamServerInterceptor()),
+		grpc.ChainUnaryInterceptor(UnaryValidationInterceptor(true)),
+		grpc.ChainStreamInterceptor(StreamValidationInterceptor(true)),
 	}
 	return serverOptions
 }
@@ -224,34 +255,46 @@ func WithValidation() []grpc.ServerOption {
 // WithErrorDetails returns gRPC server options with request validator
 func WithErrorDetails() []grpc.ServerOption {
 	serverOptions := []grpc.ServerOption{
-		grpc.UnaryInterceptor(UnaryErrorInterceptor()),
-		grpc.StreamInterceptor(StreamErrorInterceptor()),
+		grpc.ChainUnaryInterceptor(UnaryErrorInterceptor()),
+		grpc.ChainStreamInterceptor(StreamErrorInterceptor()),
 	}
 	return serverOptions
 }
 
-// WithSecure returns gRPC server option with SSL credentials
+// NewSecure returns gRPC server option with SSL credentials, it fails on invalid certificate material
+func NewSecure(ca, cert, key []byte, mutual bool) (grpc.ServerOption, error) {
+	tlsCfg, err := tls.NewCertificate(ca, cert, key, mutual)
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Creds(credentials.NewTLS(tlsCfg)), nil
+}
+
+// WithSecure returns gRPC server option with SSL credentials, invalid certificate material is logged,
+// see tls.WithCertificate.
+//
+// Deprecated: use NewSecure, it returns the error instead.
 func WithSecure(ca, cert, key []byte, mutual bool) grpc.ServerOption {
-	tlsCfg := tls.WithCertificate(ca, cert, key, mutual)
-	return grpc.Creds(credentials.NewTLS(tlsCfg))
+	return grpc.Creds(credentials.NewTLS(tls.WithCertificate(ca, cert, key, mutual)))
 }
 
-// WithDefault returns default gRPC server option with validation, recovery, auth and error interceptor
+// WithSecureSource returns gRPC server option with SSL credentials reloaded from source on rotation
+func WithSecureSource(source *tls.Source, mutual bool) grpc.ServerOption {
+	cfg := source.ServerConfig(mutual)
+	// handshakes of mutual TLS copy cfg, not the copy of the credentials that adds h2
+	cfg.NextProtos = []string{"h2"}
+	return grpc.Creds(credentials.NewTLS(cfg))
+}
+
+// DialSecureSource returns gRPC dial option with client SSL credentials reloaded from source on rotation
+func DialSecureSource(source *tls.Source, serverName string) grpc.DialOption {
+	return grpc.WithTransportCredentials(credentials.NewTLS(source.ClientConfig(serverName)))
+}
+
+// WithDefault returns default gRPC server option with recovery, error, auth and validation interceptor,
+// use WithChain to customize the stages.
 func WithDefault() []grpc.ServerOption {
-	unaryRecovery, streamRecovery := recoveryInterceptor()
-	serverOptions := []grpc.ServerOption{
-		grpc.ChainUnaryInterceptor(
-			unaryRecovery,
-			validator.UnaryServerInterceptor(),
-			UnaryAuthInterceptor(),
-			UnaryErrorInterceptor(),
-		),
-		grpc.ChainStreamInterceptor(
-			streamRecovery,
-			validator.StreamServerInterceptor(),
-			StreamErrorInterceptor(),
-		)}
-	return serverOptions
+	return WithChain()
 }
 
 func WithGoogleServiceAccount(firebaseClientEmail, firebaseClientPrivatekey string) (*oauth2.Token, error) {
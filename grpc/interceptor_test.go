@@ -0,0 +1,92 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	svcerr "github.com/budhip/common/error"
+	"github.com/budhip/common/tls/tlstest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryErrorInterceptor(t *testing.T) {
+	serviceError := svcerr.ServiceError{
+		Status:           codes.InvalidArgument,
+		Code:             "INVALID_ARGUMENT",
+		Message:          "invalid request",
+		Attributes:       map[string]string{"email": "invalid email"},
+		Domain:           "user",
+		Locale:           "id-ID",
+		LocalizedMessage: "permintaan tidak valid",
+		FieldViolations:  []svcerr.FieldViolation{{Field: "email", Description: "invalid email"}},
+		RetryAfter:       time.Second,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, serviceError
+	}
+
+	_, err := UnaryErrorInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.InvalidArgument {
+		t.Fatalf("bad status: %v", err)
+	}
+
+	var found int
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *Error:
+			if d.Code != serviceError.Code {
+				t.Fatalf("bad error code: %v", d.Code)
+			}
+			found++
+		case *errdetails.ErrorInfo:
+			if d.Reason != serviceError.Code || d.Domain != serviceError.Domain {
+				t.Fatalf("bad error info: %v", d)
+			}
+			found++
+		case *errdetails.BadRequest:
+			if len(d.FieldViolations) != 1 || d.FieldViolations[0].Field != "email" {
+				t.Fatalf("bad field violations: %v", d)
+			}
+			found++
+		case *errdetails.RetryInfo:
+			if d.RetryDelay.AsDuration() != time.Second {
+				t.Fatalf("bad retry delay: %v", d.RetryDelay)
+			}
+			found++
+		case *errdetails.LocalizedMessage:
+			if d.Message != serviceError.LocalizedMessage {
+				t.Fatalf("bad localized message: %v", d.Message)
+			}
+			found++
+		}
+	}
+	if found != 5 {
+		t.Fatalf("bad details: %v", st.Details())
+	}
+}
+
+func TestSecure(t *testing.T) {
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ca.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewSecure(nil, server.CertPEM, server.KeyPEM, false); err != nil {
+		t.Fatalf("CA should be optional without mutual TLS: %v", err)
+	}
+	if _, err := NewSecure(nil, server.CertPEM, server.KeyPEM, true); err == nil {
+		t.Fatalf("mutual TLS without CA should fail")
+	}
+	if option := WithSecure(nil, []byte("invalid"), nil, true); option == nil {
+		t.Fatalf("invalid certificate material should be logged, not fail")
+	}
+}
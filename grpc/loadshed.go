@@ -0,0 +1,82 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	svcerr "github.com/budhip/common/error"
+	"github.com/budhip/common/loadshed"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const healthCheckService = "/grpc.health.v1.Health/"
+
+// Prioritizer returns the load shedding priority of a call
+type Prioritizer func(ctx context.Context, fullMethod string) loadshed.Priority
+
+// PriorityByMethod returns prioritizer that looks up full method in priorities, e.g. to mark internal methods
+// as critical. Health checks are always critical and unknown methods are normal.
+func PriorityByMethod(priorities map[string]loadshed.Priority) Prioritizer {
+	return func(ctx context.Context, fullMethod string) loadshed.Priority {
+		if strings.HasPrefix(fullMethod, healthCheckService) {
+			return loadshed.PriorityCritical
+		}
+		if p, ok := priorities[fullMethod]; ok {
+			return p
+		}
+		return loadshed.PriorityNormal
+	}
+}
+
+// overloaded reports whether err signals that the server is overloaded
+func overloaded(err error) bool {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.ResourceExhausted, codes.Unavailable:
+		return true
+	}
+	return false
+}
+
+func shedError() error {
+	return grpcError(svcerr.ServiceError{
+		Status:  codes.Unavailable,
+		Code:    codeName(codes.Unavailable),
+		Message: "server is overloaded, please retry later",
+	})
+}
+
+// UnaryLoadSheddingInterceptor returns a new unary server interceptor that sheds calls with Unavailable
+// once the adaptive concurrency limit is reached
+func UnaryLoadSheddingInterceptor(limiter *loadshed.Limiter, priority Prioritizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		token, ok := limiter.Acquire(priority(ctx, info.FullMethod))
+		if !ok {
+			return nil, shedError()
+		}
+		// deferred so that a panicking handler returns its slot too
+		defer func() {
+			token.Done(overloaded(err) || ctx.Err() == context.DeadlineExceeded)
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamLoadSheddingInterceptor returns a new streaming server interceptor that sheds calls with Unavailable
+// once the adaptive concurrency limit is reached, streams occupy a slot but do not adjust the limit
+func StreamLoadSheddingInterceptor(limiter *loadshed.Limiter, priority Prioritizer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		token, ok := limiter.Acquire(priority(stream.Context(), info.FullMethod))
+		if !ok {
+			return shedError()
+		}
+		// stream duration is not a latency signal, it only occupies a slot
+		defer token.Release()
+
+		return handler(srv, stream)
+	}
+}
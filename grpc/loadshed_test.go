@@ -0,0 +1,66 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/budhip/common/loadshed"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryLoadSheddingInterceptor(t *testing.T) {
+	limiter := loadshed.NewLimiter(loadshed.Config{Name: "test", InitialLimit: 5, MaxLimit: 5})
+	interceptor := UnaryLoadSheddingInterceptor(limiter, PriorityByMethod(map[string]loadshed.Priority{
+		"/report.Report/Export": loadshed.PriorityLow,
+	}))
+	call := func(method string, handler grpc.UnaryHandler) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	// calls in flight, low priority calls may only use 80% of the limit
+	var tokens []*loadshed.Token
+	for i := 0; i < 4; i++ {
+		token, _ := limiter.Acquire(loadshed.PriorityNormal)
+		tokens = append(tokens, token)
+	}
+	if err := call("/report.Report/Export", ok); status.Code(err) != codes.Unavailable {
+		t.Fatalf("low priority call should be shed: %v", err)
+	}
+	if err := call("/payment.Payment/Pay", ok); err != nil {
+		t.Fatalf("call under the limit should pass: %v", err)
+	}
+
+	token, _ := limiter.Acquire(loadshed.PriorityNormal)
+	tokens = append(tokens, token)
+	if err := call("/payment.Payment/Pay", ok); status.Code(err) != codes.Unavailable {
+		t.Fatalf("call over the limit should be shed: %v", err)
+	}
+	if err := call("/grpc.health.v1.Health/Check", ok); err != nil {
+		t.Fatalf("health check should never be shed: %v", err)
+	}
+	for _, token := range tokens {
+		token.Release()
+	}
+
+	for i := 0; i < 5; i++ {
+		func() {
+			defer func() {
+				if p := recover(); p != "boom" {
+					t.Fatalf("panic should be propagated: %v", p)
+				}
+			}()
+			_ = call("/payment.Payment/Pay", func(ctx context.Context, req interface{}) (interface{}, error) {
+				panic("boom")
+			})
+		}()
+	}
+	if err := call("/payment.Payment/Pay", ok); err != nil {
+		t.Fatalf("panicking calls should return their slot: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package grpc
+
+import (
+	"context"
+	"log"
+	"time"
+
+	cctx "github.com/budhip/common/context"
+	"github.com/budhip/common/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	log.Printf("grpc call: method=%s code=%s duration=%s cID=%s",
+		method, status.Code(err), time.Since(start), cctx.GetContextAsString(ctx, cctx.CtxCID))
+}
+
+func countCall(method string, start time.Time, err error) {
+	code := status.Code(err).String()
+	metrics.NewCounter("grpc_server_handled_total", "method", method, "code", code).Add(1)
+	metrics.NewCounter("grpc_server_handling_seconds_total", "method", method).Add(time.Since(start).Seconds())
+}
+
+// UnaryLoggingInterceptor returns a new unary server interceptor that logs every call
+func UnaryLoggingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamLoggingInterceptor returns a new streaming server interceptor that logs every call
+func StreamLoggingInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		logCall(stream.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+// UnaryMetricsInterceptor returns a new unary server interceptor that counts every call and its duration
+func UnaryMetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		countCall(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamMetricsInterceptor returns a new streaming server interceptor that counts every call and its duration
+func StreamMetricsInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		countCall(info.FullMethod, start, err)
+		return err
+	}
+}
@@ -0,0 +1,54 @@
+package grpc
+
+import (
+	"context"
+	"log"
+
+	"github.com/budhip/common/config"
+	"github.com/budhip/common/secrets"
+	"google.golang.org/grpc"
+)
+
+// MaintenanceConfig holds the parameters of UnaryMaintenanceInterceptor, its tags load it with the config package
+type MaintenanceConfig struct {
+	FirebaseClientEmail string `required:"true"`
+	// FirebaseClientPrivateKey is required unless MaintenanceInterceptorWithSecret reads it from a provider
+	FirebaseClientPrivateKey string `secret:"true"`
+	ProjectID                string `required:"true"`
+	BaseURL                  string `default:"https://firebaseremoteconfig.googleapis.com"`
+	Environment              string `required:"true"`
+	// Services maps the remote config parameter of every service to its full method
+	Services map[string]string
+	// BillPaymentRequests maps bill payment product types to their remote config parameter
+	BillPaymentRequests map[int]string
+}
+
+// String returns config with the private key redacted
+func (c MaintenanceConfig) String() string {
+	return config.String(c)
+}
+
+// MaintenanceInterceptor returns UnaryMaintenanceInterceptor of c
+func MaintenanceInterceptor(c MaintenanceConfig) grpc.UnaryServerInterceptor {
+	return UnaryMaintenanceInterceptor(c.FirebaseClientEmail, c.FirebaseClientPrivateKey, c.ProjectID, c.BaseURL,
+		c.Environment, c.Services, c.BillPaymentRequests)
+}
+
+// MaintenanceInterceptorWithSecret returns MaintenanceInterceptor of c with the private key read from secret
+// secretName of provider on every call, so a rotated key is used. Wrap provider in secrets.NewCache to bound the
+// lookups. Calls are not checked for maintenance while the key cannot be read.
+func MaintenanceInterceptorWithSecret(c MaintenanceConfig, provider secrets.Provider,
+	secretName string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		key, err := secrets.String(ctx, provider, secretName)
+		if err != nil {
+			log.Printf("maintenance private key error: %v", err)
+			return handler(ctx, req)
+		}
+
+		keyed := c
+		keyed.FirebaseClientPrivateKey = key
+		return MaintenanceInterceptor(keyed)(ctx, req, info, handler)
+	}
+}
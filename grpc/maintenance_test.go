@@ -0,0 +1,25 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/budhip/common/secrets"
+	"google.golang.org/grpc"
+)
+
+func TestMaintenanceInterceptorWithSecret(t *testing.T) {
+	interceptor := MaintenanceInterceptorWithSecret(MaintenanceConfig{
+		Services: map[string]string{"payment": "/payment.Payment/Pay"},
+	}, secrets.Env{Prefix: "TEST_MAINTENANCE_"}, "firebase-private-key")
+
+	var called bool
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/payment.Payment/Pay"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			return nil, nil
+		})
+	if err != nil || !called {
+		t.Fatalf("call should not be checked without the private key: %v %v", called, err)
+	}
+}
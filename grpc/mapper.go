@@ -0,0 +1,149 @@
+package grpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	svcerr "github.com/budhip/common/error"
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrorMapper converts an error that is not a service error into service error.
+// It returns false when the error is not recognized.
+type ErrorMapper func(err error) (svcerr.ServiceError, bool)
+
+// MySQL server error numbers, see https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+const (
+	mysqlLockWaitTimeout     = 1205
+	mysqlDeadlock            = 1213
+	mysqlDuplicateEntry      = 1062
+	mysqlRowIsReferenced     = 1451
+	mysqlNoReferencedRow     = 1452
+	mysqlDataTooLong         = 1406
+	mysqlQueryInterrupted    = 1317
+	mysqlMaxExecutionTimeOut = 3024
+)
+
+// sqlState is implemented by postgres driver errors such as pgconn.PgError and pq.Error
+type sqlState interface {
+	SQLState() string
+}
+
+func newServiceError(code codes.Code, message string) svcerr.ServiceError {
+	return svcerr.ServiceError{
+		Status:  code,
+		Code:    codeName(code),
+		Message: message,
+	}
+}
+
+// codeName converts gRPC code such as AlreadyExists into ALREADY_EXISTS
+func codeName(code codes.Code) string {
+	var b strings.Builder
+	for i, r := range code.String() {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
+
+// ContextErrorMapper maps context cancellation and deadline errors
+func ContextErrorMapper(err error) (svcerr.ServiceError, bool) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return newServiceError(codes.DeadlineExceeded, "deadline exceeded"), true
+	case errors.Is(err, context.Canceled):
+		return newServiceError(codes.Canceled, "request canceled"), true
+	}
+	return svcerr.ServiceError{}, false
+}
+
+// SQLErrorMapper maps database/sql errors
+func SQLErrorMapper(err error) (svcerr.ServiceError, bool) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return newServiceError(codes.NotFound, "not found"), true
+	case errors.Is(err, sql.ErrTxDone), errors.Is(err, sql.ErrConnDone):
+		return newServiceError(codes.Aborted, "transaction aborted"), true
+	}
+	return svcerr.ServiceError{}, false
+}
+
+// MySQLErrorMapper maps go-sql-driver/mysql server errors
+func MySQLErrorMapper(err error) (svcerr.ServiceError, bool) {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return svcerr.ServiceError{}, false
+	}
+
+	switch mysqlErr.Number {
+	case mysqlDuplicateEntry:
+		return newServiceError(codes.AlreadyExists, "already exists"), true
+	case mysqlDeadlock, mysqlLockWaitTimeout:
+		return newServiceError(codes.Aborted, "transaction aborted, please retry"), true
+	case mysqlRowIsReferenced, mysqlNoReferencedRow:
+		return newServiceError(codes.FailedPrecondition, "referenced data violation"), true
+	case mysqlDataTooLong:
+		return newServiceError(codes.InvalidArgument, "data too long"), true
+	case mysqlQueryInterrupted, mysqlMaxExecutionTimeOut:
+		return newServiceError(codes.DeadlineExceeded, "deadline exceeded"), true
+	}
+	return svcerr.ServiceError{}, false
+}
+
+// PostgresErrorMapper maps postgres errors by their SQLSTATE code,
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html
+func PostgresErrorMapper(err error) (svcerr.ServiceError, bool) {
+	var pgErr sqlState
+	if !errors.As(err, &pgErr) {
+		return svcerr.ServiceError{}, false
+	}
+
+	state := pgErr.SQLState()
+	switch state {
+	case "23505": // unique_violation
+		return newServiceError(codes.AlreadyExists, "already exists"), true
+	case "40001", "40P01", "55P03": // serialization_failure, deadlock_detected, lock_not_available
+		return newServiceError(codes.Aborted, "transaction aborted, please retry"), true
+	case "23503", "23514": // foreign_key_violation, check_violation
+		return newServiceError(codes.FailedPrecondition, "constraint violation"), true
+	case "23502": // not_null_violation
+		return newServiceError(codes.InvalidArgument, "missing required value"), true
+	case "57014": // query_canceled
+		return newServiceError(codes.DeadlineExceeded, "deadline exceeded"), true
+	}
+	if strings.HasPrefix(state, "22") { // data exception
+		return newServiceError(codes.InvalidArgument, "invalid data"), true
+	}
+	return svcerr.ServiceError{}, false
+}
+
+// DefaultErrorMappers returns the built-in error mappers
+func DefaultErrorMappers() []ErrorMapper {
+	return []ErrorMapper{
+		ContextErrorMapper,
+		SQLErrorMapper,
+		MySQLErrorMapper,
+		PostgresErrorMapper,
+	}
+}
+
+// mapError returns err as service error, using mappers when it is not a service error yet
+func mapError(err error, mappers []ErrorMapper) (svcerr.ServiceError, bool) {
+	var serviceError svcerr.ServiceError
+	if ok := errors.As(err, &serviceError); ok {
+		return serviceError, true
+	}
+
+	for _, mapper := range mappers {
+		if serviceError, ok := mapper(err); ok {
+			return serviceError, true
+		}
+	}
+	return serviceError, false
+}
@@ -0,0 +1,49 @@
+package grpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testPgError struct {
+	code string
+}
+
+func (e testPgError) Error() string    { return "pg error " + e.code }
+func (e testPgError) SQLState() string { return e.code }
+
+func TestUnaryErrorInterceptorMapper(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{err: sql.ErrNoRows, code: codes.NotFound},
+		{err: fmt.Errorf("find user: %w", sql.ErrNoRows), code: codes.NotFound},
+		{err: &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, code: codes.AlreadyExists},
+		{err: &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, code: codes.Aborted},
+		{err: &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, code: codes.Aborted},
+		{err: testPgError{code: "23505"}, code: codes.AlreadyExists},
+		{err: testPgError{code: "40P01"}, code: codes.Aborted},
+		{err: context.DeadlineExceeded, code: codes.DeadlineExceeded},
+		{err: errors.New("unknown"), code: codes.Unknown},
+	}
+
+	for _, tt := range tests {
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, tt.err
+		}
+
+		_, err := UnaryErrorInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+		if got := status.Code(err); got != tt.code {
+			t.Fatalf("bad status for %v: %v", tt.err, got)
+		}
+	}
+}
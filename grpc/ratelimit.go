@@ -0,0 +1,132 @@
+package grpc
+
+import (
+	"context"
+	"log"
+	"net"
+
+	cctx "github.com/budhip/common/context"
+	svcerr "github.com/budhip/common/error"
+	"github.com/budhip/common/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// RateLimitKey returns the key a call is limited by, false skips limiting the call
+type RateLimitKey func(ctx context.Context, fullMethod string) (string, bool)
+
+// RateLimitByMethod limits every call of a method together
+func RateLimitByMethod() RateLimitKey {
+	return func(ctx context.Context, fullMethod string) (string, bool) {
+		return fullMethod, true
+	}
+}
+
+// RateLimitByUser limits calls of a method per cID, use UnaryAuthInterceptor before the rate limiter
+func RateLimitByUser() RateLimitKey {
+	return func(ctx context.Context, fullMethod string) (string, bool) {
+		cID := cctx.GetContextAsString(ctx, cctx.CtxCID)
+		if len(cID) == 0 {
+			return "", false
+		}
+		return fullMethod + "|user:" + cID, true
+	}
+}
+
+// RateLimitByPeerIP limits calls of a method per peer IP
+func RateLimitByPeerIP() RateLimitKey {
+	return func(ctx context.Context, fullMethod string) (string, bool) {
+		p, ok := peer.FromContext(ctx)
+		if !ok || p.Addr == nil {
+			return "", false
+		}
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return fullMethod + "|ip:" + host, true
+	}
+}
+
+// RateLimitByAPIKey limits calls of a method per API key sent in metadata key, the key is hashed
+func RateLimitByAPIKey(key string) RateLimitKey {
+	return func(ctx context.Context, fullMethod string) (string, bool) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(key)
+		if len(values) == 0 || len(values[0]) == 0 {
+			return "", false
+		}
+		return fullMethod + "|key:" + ratelimit.HashKey(values[0]), true
+	}
+}
+
+// RateLimitFallback uses the first key that applies, e.g. user then peer IP for anonymous calls
+func RateLimitFallback(keys ...RateLimitKey) RateLimitKey {
+	return func(ctx context.Context, fullMethod string) (string, bool) {
+		for _, key := range keys {
+			if k, ok := key(ctx, fullMethod); ok {
+				return k, true
+			}
+		}
+		return "", false
+	}
+}
+
+// rateLimit returns resource exhausted error when the call is over its limit. Limiter failures let the call through.
+func rateLimit(ctx context.Context, fullMethod string, limiter ratelimit.Limiter,
+	limits *ratelimit.Limits, key RateLimitKey) error {
+	limit, ok := limits.Get(fullMethod)
+	if !ok {
+		return nil
+	}
+	k, ok := key(ctx, fullMethod)
+	if !ok {
+		return nil
+	}
+
+	result, err := limiter.Allow(ctx, k, limit)
+	if err != nil {
+		log.Printf("rate limiter error: %v", err)
+		return nil
+	}
+	if result.Allowed {
+		return nil
+	}
+
+	return grpcError(svcerr.ServiceError{
+		Status:     codes.ResourceExhausted,
+		Code:       codeName(codes.ResourceExhausted),
+		Message:    "rate limit exceeded",
+		RetryAfter: result.RetryAfter,
+	})
+}
+
+// UnaryRateLimitInterceptor returns a new unary server interceptor that rejects calls over the limit
+// of their method with ResourceExhausted and a retry hint
+func UnaryRateLimitInterceptor(limiter ratelimit.Limiter, limits *ratelimit.Limits,
+	key RateLimitKey) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if err := rateLimit(ctx, info.FullMethod, limiter, limits, key); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamRateLimitInterceptor returns a new streaming server interceptor that rejects calls over the limit
+// of their method with ResourceExhausted and a retry hint
+func StreamRateLimitInterceptor(limiter ratelimit.Limiter, limits *ratelimit.Limits,
+	key RateLimitKey) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := rateLimit(stream.Context(), info.FullMethod, limiter, limits, key); err != nil {
+			return err
+		}
+
+		return handler(srv, stream)
+	}
+}
@@ -0,0 +1,96 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/budhip/common/ratelimit"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// recordingLimiter records the keys of the calls it limits
+type recordingLimiter struct {
+	ratelimit.Limiter
+	keys []string
+	err  error
+}
+
+func (l *recordingLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	l.keys = append(l.keys, key)
+	if l.err != nil {
+		return ratelimit.Result{}, l.err
+	}
+	return l.Limiter.Allow(ctx, key, limit)
+}
+
+func TestUnaryRateLimitInterceptor(t *testing.T) {
+	limiter := &recordingLimiter{Limiter: ratelimit.NewTokenBucket()}
+	limits := ratelimit.NewLimits(nil, map[string]ratelimit.Limit{
+		"/payment.Payment/Pay": {Requests: 1, Period: time.Minute},
+	})
+	interceptor := UnaryRateLimitInterceptor(limiter, limits, RateLimitByAPIKey("x-api-key"))
+	call := func(method, apiKey string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", apiKey))
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+		return err
+	}
+
+	if err := call("/payment.Payment/Pay", "secret-1"); err != nil {
+		t.Fatalf("first call should be allowed: %v", err)
+	}
+	err := call("/payment.Payment/Pay", "secret-1")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("call over the limit should be rejected: %v", err)
+	}
+	var retryInfo *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryInfo = info
+		}
+	}
+	if retryInfo == nil || retryInfo.GetRetryDelay().AsDuration() <= 0 {
+		t.Fatalf("rejected call should carry a retry hint: %v", status.Convert(err).Details())
+	}
+
+	if err := call("/payment.Payment/Pay", "secret-2"); err != nil {
+		t.Fatalf("another API key should have its own limit: %v", err)
+	}
+	if err := call("/payment.Payment/Refund", "secret-1"); err != nil {
+		t.Fatalf("method without limit should be allowed: %v", err)
+	}
+	if err := call("/payment.Payment/Pay", ""); err != nil {
+		t.Fatalf("call without API key should not be limited: %v", err)
+	}
+	for _, key := range limiter.keys {
+		if strings.Contains(key, "secret") {
+			t.Fatalf("API key should be hashed: %v", key)
+		}
+	}
+
+	limiter.err = errors.New("redis is down")
+	if err := call("/payment.Payment/Pay", "secret-1"); err != nil {
+		t.Fatalf("limiter failure should let the call through: %v", err)
+	}
+}
+
+func TestRateLimitFallback(t *testing.T) {
+	key := RateLimitFallback(RateLimitByUser(), RateLimitByAPIKey("x-api-key"))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "secret"))
+	if k, ok := key(ctx, "/payment.Payment/Pay"); !ok || k != "/payment.Payment/Pay|key:"+ratelimit.HashKey("secret") {
+		t.Fatalf("anonymous call should be limited by API key: %v %v", k, ok)
+	}
+	if _, ok := key(context.Background(), "/payment.Payment/Pay"); ok {
+		t.Fatalf("call without any key should not be limited")
+	}
+}
@@ -0,0 +1,47 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/budhip/common/recovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func recoverPanic(ctx context.Context, method string, p interface{}, reporters []recovery.Reporter) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	incident := recovery.NewIncident(ctx, method, p, recovery.Metadata(md))
+	recovery.Report(ctx, incident, reporters...)
+
+	return grpcError(incident.ServiceError())
+}
+
+// UnaryRecoveryInterceptor returns a new unary server interceptor that recovers from panic,
+// reports the incident with its stack and request metadata, and returns internal error with the incident id.
+func UnaryRecoveryInterceptor(reporters ...recovery.Reporter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recoverPanic(ctx, info.FullMethod, p, reporters)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoveryInterceptor returns a new streaming server interceptor that recovers from panic,
+// reports the incident with its stack and request metadata, and returns internal error with the incident id.
+func StreamRecoveryInterceptor(reporters ...recovery.Reporter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recoverPanic(stream.Context(), info.FullMethod, p, reporters)
+			}
+		}()
+
+		return handler(srv, stream)
+	}
+}
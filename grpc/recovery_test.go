@@ -0,0 +1,69 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/budhip/common/recovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryRecoveryInterceptor(t *testing.T) {
+	var got recovery.Incident
+	reporter := func(ctx context.Context, incident recovery.Incident) {
+		got = incident
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"cid", "123", "x-request-id", "req-1", "authorization", "Bearer secret"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.User/Get"}
+
+	_, err := UnaryRecoveryInterceptor(reporter)(ctx, nil, info, handler)
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("bad status: %v", err)
+	}
+
+	if got.Method != info.FullMethod || got.CID != "123" || got.RequestID != "req-1" {
+		t.Fatalf("bad incident: %+v", got)
+	}
+	if !strings.Contains(string(got.Stack), "panic") {
+		t.Fatalf("bad stack: %s", got.Stack)
+	}
+	if got.Metadata["authorization"] == "Bearer secret" {
+		t.Fatalf("authorization is not redacted")
+	}
+	if !strings.Contains(status.Convert(err).Message(), got.ID) {
+		t.Fatalf("bad message: %v", err)
+	}
+}
+
+func TestStreamRecoveryInterceptor(t *testing.T) {
+	var got recovery.Incident
+	reporter := func(ctx context.Context, incident recovery.Incident) {
+		got = incident
+	}
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		panic("boom")
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("cid", "123"))
+	info := &grpc.StreamServerInfo{FullMethod: "/user.User/Watch", IsServerStream: true}
+
+	err := StreamRecoveryInterceptor(reporter)(nil, &serverStream{ctx: ctx}, info, handler)
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("bad status: %v", err)
+	}
+	if got.Method != info.FullMethod || got.CID != "123" || got.Value != "boom" {
+		t.Fatalf("bad incident: %+v", got)
+	}
+	if !strings.Contains(status.Convert(err).Message(), got.ID) {
+		t.Fatalf("bad message: %v", err)
+	}
+}
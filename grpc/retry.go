@@ -0,0 +1,114 @@
+package grpc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/budhip/common/retry"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// RetryConfig configures the retry client interceptor
+type RetryConfig struct {
+	// Policy of retries, a zero Backoff defaults to retry.DefaultBackoff
+	Policy retry.Policy
+	// Codes are the retryable status codes, Unavailable when empty
+	Codes []codes.Code
+	// Idempotent overrides the idempotency_level option of methods by full method
+	Idempotent map[string]bool
+}
+
+func (c RetryConfig) retryable(code codes.Code) bool {
+	if len(c.Codes) == 0 {
+		return code == codes.Unavailable
+	}
+	for _, c := range c.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotent reports whether method may be retried, from config or from its proto option
+// idempotency_level = IDEMPOTENT or NO_SIDE_EFFECTS
+func (c RetryConfig) idempotent(fullMethod string) bool {
+	if idempotent, ok := c.Idempotent[fullMethod]; ok {
+		return idempotent
+	}
+
+	name := protoreflect.FullName(strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1))
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return false
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return false
+	}
+	opts, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok {
+		return false
+	}
+	return opts.GetIdempotencyLevel() != descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+}
+
+// retryAfterHint returns the retry delay sent by server as RetryInfo detail or retry_after trailer in milliseconds
+func retryAfterHint(st *status.Status, trailer metadata.MD) time.Duration {
+	for _, detail := range st.Details() {
+		if d, ok := detail.(*errdetails.RetryInfo); ok && d.RetryDelay != nil {
+			return d.RetryDelay.AsDuration()
+		}
+	}
+
+	if values := trailer.Get(retryAfter); len(values) > 0 {
+		if ms, err := strconv.ParseInt(values[0], 10, 64); err == nil {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// UnaryRetryClientInterceptor returns a new unary client interceptor that retries idempotent methods
+// failing with a retryable code, using exponential backoff with jitter, the server retry hint and retry budget
+func UnaryRetryClientInterceptor(config RetryConfig) grpc.UnaryClientInterceptor {
+	if config.Policy.Backoff == (retry.Backoff{}) {
+		config.Policy.Backoff = retry.DefaultBackoff
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if config.Policy.MaxAttempts < 2 || !config.idempotent(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		for attempt := 1; ; attempt++ {
+			var trailer metadata.MD
+			// the capacity limit makes append copy opts instead of writing into the array of the caller
+			err := invoker(ctx, method, req, reply, cc, append(opts[:len(opts):len(opts)], grpc.Trailer(&trailer))...)
+			if err == nil {
+				config.Policy.Success()
+				return nil
+			}
+
+			st := status.Convert(err)
+			if !config.retryable(st.Code()) || !config.Policy.Allow(attempt) {
+				return err
+			}
+
+			delay := config.Policy.Delay(attempt, retryAfterHint(st, trailer))
+			if sleepErr := retry.Sleep(ctx, delay); sleepErr != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	svcerr "github.com/budhip/common/error"
+	"github.com/budhip/common/retry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryRetryClientInterceptor(t *testing.T) {
+	config := RetryConfig{
+		Policy: retry.Policy{
+			MaxAttempts: 3,
+			Backoff:     retry.Backoff{Initial: time.Millisecond},
+		},
+		Idempotent: map[string]bool{"/user.User/Get": true},
+	}
+
+	tests := []struct {
+		method   string
+		err      error
+		attempts int
+		minDelay time.Duration
+	}{
+		{method: "/user.User/Get", err: status.Error(codes.Unavailable, "unavailable"), attempts: 3},
+		{method: "/user.User/Get", err: status.Error(codes.InvalidArgument, "invalid"), attempts: 1},
+		{method: "/user.User/Create", err: status.Error(codes.Unavailable, "unavailable"), attempts: 1},
+		{method: "/user.User/Get", err: grpcError(svcerr.ServiceError{
+			Status:     codes.Unavailable,
+			RetryAfter: 20 * time.Millisecond,
+		}), attempts: 3, minDelay: 40 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		var attempts int
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+			opts ...grpc.CallOption) error {
+			attempts++
+			return tt.err
+		}
+
+		start := time.Now()
+		err := UnaryRetryClientInterceptor(config)(context.Background(), tt.method, nil, nil, nil, invoker)
+		if status.Code(err) != status.Code(tt.err) || attempts != tt.attempts {
+			t.Fatalf("bad retry of %v: %v attempts, %v", tt.method, attempts, err)
+		}
+		if elapsed := time.Since(start); elapsed < tt.minDelay {
+			t.Fatalf("retry hint is not honored: %v", elapsed)
+		}
+	}
+}
+
+func TestUnaryRetryClientInterceptorOptions(t *testing.T) {
+	config := RetryConfig{
+		Policy:     retry.Policy{MaxAttempts: 2},
+		Idempotent: map[string]bool{"/user.User/Get": true},
+	}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	opts := make([]grpc.CallOption, 1, 2)
+	opts[0] = grpc.WaitForReady(true)
+	if err := UnaryRetryClientInterceptor(config)(context.Background(), "/user.User/Get", nil, nil, nil, invoker,
+		opts...); err != nil {
+		t.Fatal(err)
+	}
+	if spare := opts[:2][1]; spare != nil {
+		t.Fatalf("options of the caller should not be modified: %v", spare)
+	}
+}
@@ -0,0 +1,148 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	svcerr "github.com/budhip/common/error"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const invalidArgument = "INVALID_ARGUMENT"
+
+// validator is implemented by messages generated with protoc-gen-validate
+type validator interface {
+	Validate() error
+}
+
+// allValidator is implemented by messages generated with protoc-gen-validate v0.6.2 or later
+type allValidator interface {
+	ValidateAll() error
+}
+
+// validationError is implemented by every <Message>ValidationError generated with protoc-gen-validate
+type validationError interface {
+	error
+	Field() string
+	Reason() string
+}
+
+// multiError is implemented by every <Message>MultiError generated with protoc-gen-validate
+type multiError interface {
+	error
+	AllErrors() []error
+}
+
+type causer interface {
+	Cause() error
+}
+
+func validate(req interface{}, validateAll bool) error {
+	if validateAll {
+		if v, ok := req.(allValidator); ok {
+			return v.ValidateAll()
+		}
+	}
+	if v, ok := req.(validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+func fieldPath(prefix, field string) string {
+	if len(prefix) == 0 {
+		return field
+	}
+	if len(field) == 0 {
+		return prefix
+	}
+	return prefix + "." + field
+}
+
+// fieldViolations flattens protoc-gen-validate errors, including embedded messages, into field violations
+func fieldViolations(prefix string, err error) []svcerr.FieldViolation {
+	var multi multiError
+	if errors.As(err, &multi) {
+		var violations []svcerr.FieldViolation
+		for _, e := range multi.AllErrors() {
+			violations = append(violations, fieldViolations(prefix, e)...)
+		}
+		return violations
+	}
+
+	var verr validationError
+	if errors.As(err, &verr) {
+		field := fieldPath(prefix, verr.Field())
+		if c, ok := verr.(causer); ok && c.Cause() != nil {
+			if nested := fieldViolations(field, c.Cause()); len(nested) > 0 {
+				return nested
+			}
+		}
+		return []svcerr.FieldViolation{{Field: field, Description: verr.Reason()}}
+	}
+
+	return nil
+}
+
+// validationServiceError converts protoc-gen-validate error into service error with field violations
+func validationServiceError(err error) svcerr.ServiceError {
+	serviceError := svcerr.ServiceError{
+		Status:  codes.InvalidArgument,
+		Code:    invalidArgument,
+		Message: err.Error(),
+	}
+
+	violations := fieldViolations("", err)
+	if len(violations) > 0 {
+		serviceError.FieldViolations = violations
+		serviceError.Attributes = make(map[string]string, len(violations))
+		for _, v := range violations {
+			if _, ok := serviceError.Attributes[v.Field]; !ok {
+				serviceError.Attributes[v.Field] = v.Description
+			}
+		}
+	}
+
+	return serviceError
+}
+
+// UnaryValidationInterceptor returns a new unary server interceptor that validates incoming request
+// and reports every invalid field as BadRequest detail. If validateAll is true, ValidateAll is used
+// when the message supports it so that all violations are reported at once.
+func UnaryValidationInterceptor(validateAll bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if err := validate(req, validateAll); err != nil {
+			return nil, grpcError(validationServiceError(err))
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamValidationInterceptor returns a new streaming server interceptor that validates every received message
+// and reports every invalid field as BadRequest detail.
+func StreamValidationInterceptor(validateAll bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validationServerStream{ServerStream: stream, validateAll: validateAll})
+	}
+}
+
+type validationServerStream struct {
+	grpc.ServerStream
+	validateAll bool
+}
+
+func (s *validationServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if err := validate(m, s.validateAll); err != nil {
+		return grpcError(validationServiceError(err))
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testValidationError mimics the error type generated by protoc-gen-validate
+type testValidationError struct {
+	field  string
+	reason string
+	cause  error
+}
+
+func (e testValidationError) Error() string  { return "invalid " + e.field + ": " + e.reason }
+func (e testValidationError) Field() string  { return e.field }
+func (e testValidationError) Reason() string { return e.reason }
+func (e testValidationError) Cause() error   { return e.cause }
+
+// testMultiError mimics the multi error type generated by protoc-gen-validate
+type testMultiError []error
+
+func (m testMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m testMultiError) AllErrors() []error { return m }
+
+type testRequest struct{}
+
+func (testRequest) Validate() error {
+	return testValidationError{field: "Name", reason: "value length must be at least 1 runes"}
+}
+
+func (testRequest) ValidateAll() error {
+	return testMultiError{
+		testValidationError{field: "Name", reason: "value length must be at least 1 runes"},
+		testValidationError{field: "Address", reason: "embedded message failed validation",
+			cause: testMultiError{testValidationError{field: "City", reason: "value is required"}}},
+	}
+}
+
+func TestUnaryValidationInterceptor(t *testing.T) {
+	tests := []struct {
+		validateAll bool
+		fields      []string
+	}{
+		{validateAll: false, fields: []string{"Name"}},
+		{validateAll: true, fields: []string{"Name", "Address.City"}},
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+
+	for _, tt := range tests {
+		_, err := UnaryValidationInterceptor(tt.validateAll)(context.Background(), testRequest{},
+			&grpc.UnaryServerInfo{}, handler)
+		st, _ := status.FromError(err)
+		if st.Code() != codes.InvalidArgument {
+			t.Fatalf("bad status: %v", err)
+		}
+
+		var fields []string
+		for _, detail := range st.Details() {
+			if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+				for _, v := range badRequest.FieldViolations {
+					fields = append(fields, v.Field)
+				}
+			}
+		}
+		if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+			t.Fatalf("bad field violations: %v", fields)
+		}
+	}
+}
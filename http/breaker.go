@@ -0,0 +1,32 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/budhip/common/breaker"
+)
+
+type breakerTransport struct {
+	next     http.RoundTripper
+	breakers *breaker.Group
+}
+
+// CircuitBreakerTransport returns round tripper with a circuit breaker per host. Network errors and 5xx responses
+// count as failures, requests fail fast with breaker.ErrOpen while the breaker is open.
+func CircuitBreakerTransport(next http.RoundTripper, breakers *breaker.Group) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &breakerTransport{next: next, breakers: breakers}
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := t.breakers.Get(req.URL.Host).Allow()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	done(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	return resp, err
+}
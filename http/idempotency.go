@@ -0,0 +1,150 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	cctx "github.com/budhip/common/context"
+	"github.com/budhip/common/idempotency"
+)
+
+const replayedHeader = "Idempotent-Replayed"
+
+// storedResponse is the response kept in idempotency store
+type storedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// responseRecorder writes the response through while keeping a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotency returns option for requests with Idempotency-Key header. The key is scoped by cID, method and path,
+// requests without cID get 401 Unauthorized so use Auth before it. The first response below 500 is stored for ttl
+// and replayed to duplicate requests with the same body, a different body gets 422 Unprocessable Entity.
+// Duplicates of a request still in progress get 409 Conflict for up to idempotency.Lease. Server errors release
+// the key so the request can be retried, a handler writing nothing responds 200 OK.
+func Idempotency(store idempotency.Store, ttl time.Duration) Option {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get(idempotency.Header)
+			if len(value) == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			cID := cctx.GetContextAsString(ctx, cctx.CtxCID)
+			if len(cID) == 0 {
+				// keys of anonymous callers would be shared by every one of them
+				writeError(w, http.StatusUnauthorized, "UNAUTHENTICATED",
+					"idempotency key requires an authenticated caller")
+				return
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "failed to read request body")
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			fingerprint := idempotency.Fingerprint(body)
+
+			key := idempotency.Key(cID, r.Method+" "+r.URL.Path, value)
+			record, ok, err := store.Begin(ctx, key, fingerprint, idempotency.LeaseFor(ttl))
+			if err != nil {
+				log.Printf("idempotency store error: %v", err)
+				writeError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "idempotency store is unavailable")
+				return
+			}
+			if !ok {
+				if record.Fingerprint != fingerprint {
+					writeError(w, http.StatusUnprocessableEntity, "INVALID_ARGUMENT", idempotency.ErrMismatch.Error())
+					return
+				}
+				replayResponse(w, record)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			h.ServeHTTP(recorder, r)
+
+			if recorder.status == 0 {
+				// net/http responds 200 OK to handlers that write nothing
+				recorder.status = http.StatusOK
+			}
+			if recorder.status >= http.StatusInternalServerError {
+				if err := store.Release(ctx, key); err != nil {
+					log.Printf("idempotency store error: %v", err)
+				}
+				return
+			}
+
+			response, err := json.Marshal(storedResponse{
+				Status: recorder.status,
+				Header: w.Header(),
+				Body:   recorder.body.Bytes(),
+			})
+			if err == nil {
+				err = store.Complete(ctx, key, response, ttl)
+			}
+			if err != nil {
+				log.Printf("idempotency store error: %v", err)
+			}
+		})
+	}
+}
+
+func replayResponse(w http.ResponseWriter, record idempotency.Record) {
+	if !record.Completed {
+		writeError(w, http.StatusConflict, "ABORTED", idempotency.ErrInFlight.Error())
+		return
+	}
+
+	var stored storedResponse
+	if err := json.Unmarshal(record.Response, &stored); err != nil {
+		log.Printf("idempotency store error: %v", err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "invalid stored response")
+		return
+	}
+
+	for k, v := range stored.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(replayedHeader, "true")
+	w.WriteHeader(stored.Status)
+	if _, err := w.Write(stored.Body); err != nil {
+		log.Print(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message}); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cctx "github.com/budhip/common/context"
+	"github.com/budhip/common/idempotency"
+)
+
+func TestIdempotency(t *testing.T) {
+	var calls int
+	var handler http.Handler
+	handler = NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/payments":
+			if body, _ := ioutil.ReadAll(r.Body); string(body) != "amount=100" {
+				t.Errorf("handler should read the whole body: %q", body)
+			}
+			w.Header().Set("Location", "/payments/1")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("paid"))
+		case "/refunds":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/slow":
+			// a duplicate arriving while the first request is in progress
+			handler.ServeHTTP(w, r)
+		}
+	}), Idempotency(idempotency.NewMemoryStore(), time.Minute))
+
+	send := func(cID, path, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), cctx.CtxCID, cID))
+		r.Header.Set(idempotency.Header, key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	serve := func(path, key string) *httptest.ResponseRecorder {
+		return send("cid-1", path, key, "amount=100")
+	}
+
+	for i := 0; i < 2; i++ {
+		w := serve("/payments", "abc")
+		if w.Code != http.StatusCreated || w.Body.String() != "paid" || w.Header().Get("Location") != "/payments/1" {
+			t.Fatalf("bad response %d: %v %q %v", i, w.Code, w.Body, w.Header())
+		}
+		if replayed := w.Header().Get(replayedHeader) == "true"; replayed != (i == 1) {
+			t.Fatalf("only the duplicate should be replayed: %v", w.Header())
+		}
+	}
+	if w := send("cid-1", "/payments", "abc", "amount=200"); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused with a different body should be rejected: %v", w.Code)
+	}
+	if w := send("", "/payments", "abc", "amount=100"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous request with a key should be rejected: %v", w.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("duplicate request should be replayed: %v calls", calls)
+	}
+
+	calls = 0
+	serve("/refunds", "abc")
+	serve("/refunds", "abc")
+	if calls != 2 {
+		t.Fatalf("server error should release the key: %v calls", calls)
+	}
+
+	calls = 0
+	serve("/empty", "abc")
+	if w := serve("/empty", "abc"); w.Code != http.StatusOK || w.Header().Get(replayedHeader) != "true" || calls != 1 {
+		t.Fatalf("empty response should be stored as 200 OK: %v %v after %v calls", w.Code, w.Header(), calls)
+	}
+
+	if w := serve("/slow", "abc"); w.Code != http.StatusConflict {
+		t.Fatalf("duplicate of request in progress should conflict: %v", w.Code)
+	}
+
+	calls = 0
+	serve("/payments", "")
+	serve("/payments", "")
+	if calls != 2 {
+		t.Fatalf("requests without key should not be replayed: %v calls", calls)
+	}
+}
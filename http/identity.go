@@ -0,0 +1,27 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/budhip/common/auth"
+)
+
+// Identity returns option that extracts the service identity of the client certificate into request context
+// and checks it against policy keyed by path. A nil policy allows every request.
+func Identity(policy auth.IdentityPolicy) Option {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = auth.WithPeerIdentityRequestContext(r)
+			if policy.Allow(r.Context(), r.URL.Path) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if _, ok := auth.ServiceIdentityFromContext(r.Context()); !ok {
+				writeError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "client certificate is required")
+				return
+			}
+			writeError(w, http.StatusForbidden, "PERMISSION_DENIED", "service identity is not allowed")
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package http
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	cctx "github.com/budhip/common/context"
+	"github.com/budhip/common/ratelimit"
+)
+
+// RateLimitKey returns the key a request is limited by, false skips limiting the request
+type RateLimitKey func(r *http.Request) (string, bool)
+
+// RateLimitByPath limits every request of a path together
+func RateLimitByPath() RateLimitKey {
+	return func(r *http.Request) (string, bool) {
+		return r.URL.Path, true
+	}
+}
+
+// RateLimitByUser limits requests of a path per cID, use Auth before the rate limiter
+func RateLimitByUser() RateLimitKey {
+	return func(r *http.Request) (string, bool) {
+		cID := cctx.GetContextAsString(r.Context(), cctx.CtxCID)
+		if len(cID) == 0 {
+			return "", false
+		}
+		return r.URL.Path + "|user:" + cID, true
+	}
+}
+
+// RateLimitByIP limits requests of a path per remote IP
+func RateLimitByIP() RateLimitKey {
+	return func(r *http.Request) (string, bool) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if len(host) == 0 {
+			return "", false
+		}
+		return r.URL.Path + "|ip:" + host, true
+	}
+}
+
+// RateLimitByAPIKey limits requests of a path per API key sent in header, the key is hashed
+func RateLimitByAPIKey(header string) RateLimitKey {
+	return func(r *http.Request) (string, bool) {
+		apiKey := r.Header.Get(header)
+		if len(apiKey) == 0 {
+			return "", false
+		}
+		return r.URL.Path + "|key:" + ratelimit.HashKey(apiKey), true
+	}
+}
+
+// RateLimit returns option that rejects requests over the limit of their path with 429 and Retry-After header.
+// Limiter failures let the request through.
+func RateLimit(limiter ratelimit.Limiter, limits *ratelimit.Limits, key RateLimitKey) Option {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, ok := limits.Get(r.URL.Path)
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			k, ok := key(r)
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := limiter.Allow(r.Context(), k, limit)
+			if err != nil {
+				log.Printf("rate limiter error: %v", err)
+				h.ServeHTTP(w, r)
+				return
+			}
+			if result.Allowed {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "RESOURCE_EXHAUSTED", "rate limit exceeded")
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/budhip/common/ratelimit"
+)
+
+// recordingLimiter records the keys of the requests it limits
+type recordingLimiter struct {
+	ratelimit.Limiter
+	keys []string
+	err  error
+}
+
+func (l *recordingLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	l.keys = append(l.keys, key)
+	if l.err != nil {
+		return ratelimit.Result{}, l.err
+	}
+	return l.Limiter.Allow(ctx, key, limit)
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := &recordingLimiter{Limiter: ratelimit.NewTokenBucket()}
+	limits := ratelimit.NewLimits(nil, map[string]ratelimit.Limit{
+		"/payments": {Requests: 1, Period: time.Minute},
+	})
+	handler := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		RateLimit(limiter, limits, RateLimitByAPIKey("X-Api-Key")))
+	serve := func(path, apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.Header.Set("X-Api-Key", apiKey)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve("/payments", "secret-1"); w.Code != http.StatusOK {
+		t.Fatalf("first request should be allowed: %v", w.Code)
+	}
+	w := serve("/payments", "secret-1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("request over the limit should be rejected with a retry hint: %v %v", w.Code, w.Header())
+	}
+	if w := serve("/payments", "secret-2"); w.Code != http.StatusOK {
+		t.Fatalf("another API key should have its own limit: %v", w.Code)
+	}
+	if w := serve("/refunds", "secret-1"); w.Code != http.StatusOK {
+		t.Fatalf("path without limit should be allowed: %v", w.Code)
+	}
+	if w := serve("/payments", ""); w.Code != http.StatusOK {
+		t.Fatalf("request without API key should not be limited: %v", w.Code)
+	}
+	for _, key := range limiter.keys {
+		if strings.Contains(key, "secret") {
+			t.Fatalf("API key should be hashed: %v", key)
+		}
+	}
+
+	limiter.err = errors.New("redis is down")
+	if w := serve("/payments", "secret-1"); w.Code != http.StatusOK {
+		t.Fatalf("limiter failure should let the request through: %v", w.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/budhip/common/retry"
+)
+
+const idempotencyKey = "Idempotency-Key"
+
+// retryableStatus are the response status codes that are retried
+var retryableStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+type retryTransport struct {
+	next   http.RoundTripper
+	policy retry.Policy
+}
+
+// RetryTransport returns round tripper that retries idempotent requests, or requests with Idempotency-Key header,
+// on network errors and 429, 502, 503 and 504 responses. It honors the Retry-After header.
+// Requests with body are only retried when GetBody is set, as done by http.NewRequest.
+// A zero policy Backoff defaults to retry.DefaultBackoff.
+func RetryTransport(next http.RoundTripper, policy retry.Policy) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if policy.Backoff == (retry.Backoff{}) {
+		policy.Backoff = retry.DefaultBackoff
+	}
+	return &retryTransport{next: next, policy: policy}
+}
+
+func idempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return len(req.Header.Get(idempotencyKey)) > 0
+}
+
+// retryAfterHeader parses Retry-After header in seconds or HTTP date
+func retryAfterHeader(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.policy.MaxAttempts < 2 || !idempotentRequest(req) || (req.Body != nil && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if err == nil && !retryableStatus[resp.StatusCode] {
+			t.policy.Success()
+			return resp, nil
+		}
+		if req.Context().Err() != nil || !t.policy.Allow(attempt) {
+			return resp, err
+		}
+
+		delay := t.policy.Delay(attempt, retryAfterHeader(resp))
+		if sleepErr := retry.Sleep(req.Context(), delay); sleepErr != nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
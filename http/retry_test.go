@@ -0,0 +1,58 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/budhip/common/retry"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("bad body on attempt %d: %q", attempts, body)
+		}
+		if attempts < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: RetryTransport(nil, retry.Policy{
+		MaxAttempts: 3,
+		Backoff:     retry.Backoff{Initial: time.Millisecond},
+	})}
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("bad request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || attempts != 3 {
+		t.Fatalf("bad retry: status %v after %v attempts", resp.StatusCode, attempts)
+	}
+
+	attempts = 0
+	req, _ = http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("bad request: %v", err)
+	}
+	resp.Body.Close()
+
+	if attempts != 1 {
+		t.Fatalf("non idempotent request should not be retried: %v attempts", attempts)
+	}
+}
@@ -1,14 +1,28 @@
 package http
 
 import (
+	"context"
+	"encoding/json"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/budhip/common/auth"
+	"github.com/budhip/common/recovery"
+	"github.com/budhip/common/tls"
 	"github.com/gorilla/handlers"
 )
 
 type Option func(http.Handler) http.Handler
 
+type errorResponse struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	IncidentID string `json:"incident_id,omitempty"`
+}
+
 func NewHandler(handler http.Handler, options ...Option) http.Handler {
 	h := handler
 	for _, option := range options {
@@ -25,7 +39,49 @@ func Auth(handler http.Handler) http.Handler {
 }
 
 func Recover(handler http.Handler) http.Handler {
-	return handlers.RecoveryHandler(handlers.PrintRecoveryStack(true))(handler)
+	return recoverHandler(handler, nil)
+}
+
+// RecoverWith returns option that recovers from panic and passes the incident to reporters
+func RecoverWith(reporters ...recovery.Reporter) Option {
+	return func(h http.Handler) http.Handler {
+		return recoverHandler(h, reporters)
+	}
+}
+
+func recoverHandler(handler http.Handler, reporters []recovery.Reporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			incident := recovery.NewIncident(r.Context(), r.Method, p, recovery.Metadata(r.Header))
+			incident.Path = r.URL.Path
+			recovery.Report(r.Context(), incident, reporters...)
+
+			serviceError := incident.ServiceError()
+			w.Header().Set("Content-Type", "application/json")
+			if len(incident.RequestID) > 0 {
+				w.Header().Set(recovery.RequestIDKey, incident.RequestID)
+			}
+			w.Header().Set("X-Incident-Id", incident.ID)
+			w.WriteHeader(http.StatusInternalServerError)
+			if err := json.NewEncoder(w).Encode(errorResponse{
+				Code:       serviceError.Code,
+				Message:    serviceError.Message,
+				IncidentID: incident.ID,
+			}); err != nil {
+				log.Print(err)
+			}
+		}()
+
+		handler.ServeHTTP(w, r)
+	})
 }
 
 func WithDefault() Option {
@@ -36,4 +92,30 @@ func WithDefault() Option {
 
 func DefaultHandler(handler http.Handler) http.Handler {
 	return NewHandler(handler, WithDefault())
-}
\ No newline at end of file
+}
+
+// ServeTLS listen for client request with certificate served from source, it shuts down gracefully on signal
+func ServeTLS(address string, handler http.Handler, source *tls.Source, mutual bool) {
+	tlsConfig := source.ServerConfig(mutual)
+	// handshakes of mutual TLS copy tlsConfig, not the copy of the server that adds the protocols
+	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	server := &http.Server{
+		Addr:      address,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+	go func() {
+		<-c
+		log.Println("Shutting down server gracefully...")
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/budhip/common/recovery"
+)
+
+func TestRecoverWith(t *testing.T) {
+	var got recovery.Incident
+	reporter := func(ctx context.Context, incident recovery.Incident) {
+		got = incident
+	}
+	handler := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), RecoverWith(reporter))
+
+	r := httptest.NewRequest(http.MethodGet, "/users/123", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set(recovery.RequestIDKey, "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("bad status: %v", w.Code)
+	}
+	// the path is unbounded, it must not become the method label of the panic metric
+	if got.Method != http.MethodGet || got.Path != "/users/123" || got.RequestID != "req-1" {
+		t.Fatalf("bad incident: %+v", got)
+	}
+	if got.Metadata["authorization"] == "Bearer secret" {
+		t.Fatalf("authorization is not redacted")
+	}
+
+	var resp errorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.IncidentID != got.ID || w.Header().Get("X-Incident-Id") != got.ID ||
+		w.Header().Get(recovery.RequestIDKey) != "req-1" {
+		t.Fatalf("bad response: %+v %v", resp, w.Header())
+	}
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Fatalf("abort should be propagated to net/http: %v", p)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,128 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/budhip/common/internal/sweep"
+)
+
+// Header is the request header and metadata key holding the idempotency key
+const Header = "Idempotency-Key"
+
+// ErrInFlight is returned when the first call with the same key has not completed yet
+var ErrInFlight = errors.New("request with the same idempotency key is in progress")
+
+// ErrMismatch is returned when a key is reused with a request that differs from the first call
+var ErrMismatch = errors.New("idempotency key was used with a different request")
+
+// Lease is how long the first call holds its key before it completes, duplicates fail with ErrInFlight meanwhile.
+// A call that crashed before completing blocks its key for the lease instead of the whole ttl, so it should
+// exceed the longest call.
+var Lease = time.Minute
+
+// LeaseFor returns the claim duration of a key whose response is kept for ttl, the shorter of Lease and ttl
+func LeaseFor(ttl time.Duration) time.Duration {
+	if ttl < Lease {
+		return ttl
+	}
+	return Lease
+}
+
+// Record is the stored state of an idempotency key
+type Record struct {
+	Completed bool
+	Response  []byte
+	// Fingerprint of the request of the first call, see Fingerprint
+	Fingerprint string
+	ExpiresAt   time.Time
+}
+
+// Store keeps idempotency records
+type Store interface {
+	// Begin claims key for lease with the fingerprint of the request and returns true, or returns the existing
+	// record and false when key is already claimed or completed
+	Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (Record, bool, error)
+	// Complete stores the response of key, it is replayed until ttl elapsed
+	Complete(ctx context.Context, key string, response []byte, ttl time.Duration) error
+	// Release removes key, e.g. when the first call failed so that it can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// Key returns the store key of idempotency key scoped by user and method
+func Key(user, method, key string) string {
+	sum := sha256.Sum256([]byte(user + "\x00" + method + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint returns the fingerprint of a request, duplicates must send the same request as the first call
+func Fingerprint(request []byte) string {
+	sum := sha256.Sum256(request)
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryStore is an in-memory store, records are only shared within the process
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	sweep   sweep.Schedule
+	now     func() time.Time
+}
+
+// NewMemoryStore returns in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]Record),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryStore) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if m.sweep.Due(now) {
+		m.evict(now)
+	}
+	if record, ok := m.records[key]; ok && now.Before(record.ExpiresAt) {
+		return record, false, nil
+	}
+
+	m.records[key] = Record{Fingerprint: fingerprint, ExpiresAt: now.Add(lease)}
+	return Record{}, true, nil
+}
+
+func (m *MemoryStore) Complete(ctx context.Context, key string, response []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[key] = Record{
+		Completed:   true,
+		Response:    response,
+		Fingerprint: m.records[key].Fingerprint,
+		ExpiresAt:   m.now().Add(ttl),
+	}
+	return nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+	return nil
+}
+
+// evict drops expired records, it must be called with lock held
+func (m *MemoryStore) evict(now time.Time) {
+	for k, r := range m.records {
+		if !now.Before(r.ExpiresAt) {
+			delete(m.records, k)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/budhip/common/internal/sweep"
+)
+
+func TestMemoryStoreLease(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if _, ok, _ := store.Begin(ctx, "key", "", LeaseFor(time.Hour)); !ok {
+		t.Fatalf("first call should claim the key")
+	}
+	now = now.Add(Lease)
+	if _, ok, _ := store.Begin(ctx, "key", "", LeaseFor(time.Hour)); !ok {
+		t.Fatalf("crashed call should block the key only for the lease")
+	}
+
+	if lease := LeaseFor(time.Second); lease != time.Second {
+		t.Fatalf("lease should not exceed ttl: %v", lease)
+	}
+}
+
+func TestMemoryStoreEvict(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		store.Begin(ctx, key, "", time.Second)
+	}
+	store.Begin(ctx, "live", "", time.Hour)
+
+	now = now.Add(sweep.Interval)
+	if _, ok, _ := store.Begin(ctx, "live", "", time.Hour); ok {
+		t.Fatalf("live key should not be evicted")
+	}
+	if len(store.records) != 1 {
+		t.Fatalf("expired records should be evicted: %v left", len(store.records))
+	}
+}
@@ -0,0 +1,193 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PurgeInterval is how often Begin of SQLStore deletes a batch of expired records of every key
+var PurgeInterval = time.Minute
+
+// purgeBatch is the most records a purge statement deletes
+const purgeBatch = 1000
+
+// Dialect holds the statements of a database, expires_at is stored as unix milliseconds
+type Dialect struct {
+	createTable []string
+	insert      string
+	selectOne   string
+	update      string
+	delete      string
+	deleteOld   string
+	purge       string
+}
+
+// MySQL dialect
+var MySQL = Dialect{
+	createTable: []string{`CREATE TABLE IF NOT EXISTS %s (
+	idempotency_key CHAR(64) NOT NULL PRIMARY KEY,
+	completed BOOLEAN NOT NULL DEFAULT FALSE,
+	response LONGBLOB NULL,
+	fingerprint CHAR(64) NOT NULL,
+	expires_at BIGINT NOT NULL,
+	INDEX expires_at (expires_at)
+)`},
+	insert: "INSERT IGNORE INTO %s (idempotency_key, completed, fingerprint, expires_at) " +
+		"VALUES (?, FALSE, ?, ?)",
+	selectOne: "SELECT completed, response, fingerprint, expires_at FROM %s WHERE idempotency_key = ?",
+	update:    "UPDATE %s SET completed = TRUE, response = ?, expires_at = ? WHERE idempotency_key = ?",
+	delete:    "DELETE FROM %s WHERE idempotency_key = ?",
+	deleteOld: "DELETE FROM %s WHERE idempotency_key = ? AND expires_at <= ?",
+	purge:     "DELETE FROM %s WHERE expires_at <= ? LIMIT %d",
+}
+
+// Postgres dialect
+var Postgres = Dialect{
+	createTable: []string{`CREATE TABLE IF NOT EXISTS %s (
+	idempotency_key CHAR(64) NOT NULL PRIMARY KEY,
+	completed BOOLEAN NOT NULL DEFAULT FALSE,
+	response BYTEA NULL,
+	fingerprint CHAR(64) NOT NULL,
+	expires_at BIGINT NOT NULL
+)`, "CREATE INDEX IF NOT EXISTS %[1]s_expires_at ON %[1]s (expires_at)"},
+	insert: "INSERT INTO %s (idempotency_key, completed, fingerprint, expires_at) " +
+		"VALUES ($1, FALSE, $2, $3) ON CONFLICT DO NOTHING",
+	selectOne: "SELECT completed, response, fingerprint, expires_at FROM %s WHERE idempotency_key = $1",
+	update:    "UPDATE %s SET completed = TRUE, response = $1, expires_at = $2 WHERE idempotency_key = $3",
+	delete:    "DELETE FROM %s WHERE idempotency_key = $1",
+	deleteOld: "DELETE FROM %s WHERE idempotency_key = $1 AND expires_at <= $2",
+	purge: "DELETE FROM %[1]s WHERE idempotency_key IN " +
+		"(SELECT idempotency_key FROM %[1]s WHERE expires_at <= $1 LIMIT %[2]d)",
+}
+
+// SQLStore keeps records in a table of the database returned by mysql.DB or postgre.DB
+type SQLStore struct {
+	db      *sql.DB
+	table   string
+	dialect Dialect
+	now     func() time.Time
+
+	mu        sync.Mutex
+	nextPurge time.Time
+}
+
+// NewSQLStore returns store that keeps records in table, see CreateTable
+func NewSQLStore(db *sql.DB, dialect Dialect, table string) (*SQLStore, error) {
+	if !tableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid idempotency table name %q", table)
+	}
+	return &SQLStore{db: db, table: table, dialect: dialect, now: time.Now}, nil
+}
+
+// CreateTable creates the idempotency table and its index if they do not exist
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	for _, statement := range s.dialect.createTable {
+		if _, err := s.db.ExecContext(ctx, s.query(statement)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) query(statement string) string {
+	return fmt.Sprintf(statement, s.table)
+}
+
+// Purge deletes every expired record in batches and returns how many were deleted. Begin already deletes a batch
+// every PurgeInterval, Purge is for jobs that clean up tables of idle services.
+func (s *SQLStore) Purge(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		n, err := s.purge(ctx, s.now())
+		total += n
+		if err != nil || n < purgeBatch {
+			return total, err
+		}
+	}
+}
+
+func (s *SQLStore) purge(ctx context.Context, now time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(s.dialect.purge, s.table, purgeBatch), millis(now))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// purgeDue deletes a batch of expired records every PurgeInterval, full batches leave the rest to the next Begin
+func (s *SQLStore) purgeDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	due := !now.Before(s.nextPurge)
+	if due {
+		s.nextPurge = now.Add(PurgeInterval)
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+
+	n, err := s.purge(ctx, now)
+	if err != nil {
+		log.Printf("idempotency store purge error: %v", err)
+		return
+	}
+	if n == purgeBatch {
+		s.mu.Lock()
+		s.nextPurge = now
+		s.mu.Unlock()
+	}
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func (s *SQLStore) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (Record, bool, error) {
+	now := s.now()
+	s.purgeDue(ctx, now)
+
+	if _, err := s.db.ExecContext(ctx, s.query(s.dialect.deleteOld), key, millis(now)); err != nil {
+		return Record{}, false, err
+	}
+
+	result, err := s.db.ExecContext(ctx, s.query(s.dialect.insert), key, fingerprint, millis(now.Add(lease)))
+	if err != nil {
+		return Record{}, false, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return Record{}, false, err
+	} else if n == 1 {
+		return Record{}, true, nil
+	}
+
+	var record Record
+	var expiresAt int64
+	err = s.db.QueryRowContext(ctx, s.query(s.dialect.selectOne), key).
+		Scan(&record.Completed, &record.Response, &record.Fingerprint, &expiresAt)
+	if err == sql.ErrNoRows {
+		// released meanwhile, claim it again
+		return s.Begin(ctx, key, fingerprint, lease)
+	}
+	if err != nil {
+		return Record{}, false, err
+	}
+	record.ExpiresAt = time.Unix(0, expiresAt*int64(time.Millisecond))
+	return record, false, nil
+}
+
+func (s *SQLStore) Complete(ctx context.Context, key string, response []byte, ttl time.Duration) error {
+	_, err := s.db.ExecContext(ctx, s.query(s.dialect.update), response, millis(s.now().Add(ttl)), key)
+	return err
+}
+
+func (s *SQLStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.query(s.dialect.delete), key)
+	return err
+}
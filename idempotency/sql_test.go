@@ -0,0 +1,211 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// record is a row of the idempotency table
+type record struct {
+	completed   bool
+	response    []byte
+	fingerprint string
+	expiresAt   int64
+}
+
+// tableDriver keeps the idempotency table of the Postgres dialect in memory
+type tableDriver struct {
+	mu   sync.Mutex
+	rows map[string]record
+}
+
+func (d *tableDriver) Open(string) (driver.Conn, error) { return tableConn{d: d}, nil }
+
+type tableConn struct {
+	d *tableDriver
+}
+
+func (tableConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (tableConn) Close() error                        { return nil }
+func (tableConn) Begin() (driver.Tx, error)           { return nil, errors.New("not implemented") }
+
+func statement(query string) string {
+	return fmt.Sprintf(query, "idempotency_keys")
+}
+
+func (c tableConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+
+	key := args[0].Value
+	switch query {
+	case statement(Postgres.deleteOld):
+		if row, ok := c.d.rows[key.(string)]; ok && row.expiresAt <= args[1].Value.(int64) {
+			delete(c.d.rows, key.(string))
+			return driver.RowsAffected(1), nil
+		}
+	case fmt.Sprintf(Postgres.purge, "idempotency_keys", purgeBatch):
+		var n int64
+		for k, row := range c.d.rows {
+			if n < purgeBatch && row.expiresAt <= args[0].Value.(int64) {
+				delete(c.d.rows, k)
+				n++
+			}
+		}
+		return driver.RowsAffected(n), nil
+	case statement(Postgres.insert):
+		if _, ok := c.d.rows[key.(string)]; !ok {
+			c.d.rows[key.(string)] = record{fingerprint: args[1].Value.(string), expiresAt: args[2].Value.(int64)}
+			return driver.RowsAffected(1), nil
+		}
+	case statement(Postgres.update):
+		key := args[2].Value.(string)
+		if row, ok := c.d.rows[key]; ok {
+			response, _ := args[0].Value.([]byte)
+			c.d.rows[key] = record{completed: true, response: response, fingerprint: row.fingerprint,
+				expiresAt: args[1].Value.(int64)}
+			return driver.RowsAffected(1), nil
+		}
+	case statement(Postgres.delete):
+		if _, ok := c.d.rows[key.(string)]; ok {
+			delete(c.d.rows, key.(string))
+			return driver.RowsAffected(1), nil
+		}
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", query)
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c tableConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+
+	if query != statement(Postgres.selectOne) {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	r := &rows{}
+	if row, ok := c.d.rows[args[0].Value.(string)]; ok {
+		r.values = [][]driver.Value{{row.completed, row.response, row.fingerprint, row.expiresAt}}
+	}
+	return r, nil
+}
+
+type rows struct {
+	values [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return []string{"completed", "response", "fingerprint", "expires_at"} }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+type tableConnector struct {
+	d *tableDriver
+}
+
+func (c tableConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c tableConnector) Driver() driver.Driver                        { return c.d }
+
+func TestSQLStore(t *testing.T) {
+	db := sql.OpenDB(tableConnector{d: &tableDriver{rows: map[string]record{}}})
+	defer db.Close()
+
+	if _, err := NewSQLStore(db, Postgres, "keys; DROP TABLE users"); err == nil {
+		t.Fatalf("invalid table name should fail")
+	}
+	store, err := NewSQLStore(db, Postgres, "idempotency_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	key := Key("user", "POST /payments", "abc")
+	fingerprint := Fingerprint([]byte(`{"amount":100}`))
+	if _, ok, err := store.Begin(ctx, key, fingerprint, time.Minute); err != nil || !ok {
+		t.Fatalf("first call should claim the key: %v %v", ok, err)
+	}
+	record, ok, err := store.Begin(ctx, key, "other", time.Minute)
+	if err != nil || ok || record.Completed || record.Fingerprint != fingerprint {
+		t.Fatalf("duplicate should see the call in progress: %+v %v %v", record, ok, err)
+	}
+
+	if err := store.Complete(ctx, key, []byte("paid"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Minute)
+	record, ok, err = store.Begin(ctx, key, fingerprint, time.Minute)
+	if err != nil || ok || !record.Completed || string(record.Response) != "paid" || record.Fingerprint != fingerprint {
+		t.Fatalf("duplicate should replay the response: %+v %v %v", record, ok, err)
+	}
+	if !record.ExpiresAt.Equal(now.Add(30 * time.Minute).Truncate(time.Millisecond)) {
+		t.Fatalf("bad expiry: %v", record.ExpiresAt)
+	}
+
+	if err := store.Release(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.Begin(ctx, key, fingerprint, time.Minute); err != nil || !ok {
+		t.Fatalf("released key should be claimed again: %v %v", ok, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok, err := store.Begin(ctx, key, fingerprint, time.Minute); err != nil || !ok {
+		t.Fatalf("expired lease should be claimed again: %v %v", ok, err)
+	}
+}
+
+func TestSQLStorePurge(t *testing.T) {
+	table := &tableDriver{rows: map[string]record{}}
+	db := sql.OpenDB(tableConnector{d: table})
+	defer db.Close()
+
+	store, err := NewSQLStore(db, Postgres, "idempotency_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := 0; i < purgeBatch+10; i++ {
+		table.rows[fmt.Sprint(i)] = record{expiresAt: millis(now)}
+	}
+	table.rows["live"] = record{expiresAt: millis(now.Add(time.Hour))}
+
+	if _, ok, err := store.Begin(ctx, "key", "", time.Minute); err != nil || !ok {
+		t.Fatalf("first call should claim the key: %v %v", ok, err)
+	}
+	if len(table.rows) != 12 {
+		t.Fatalf("begin should purge a batch of expired records: %v left", len(table.rows))
+	}
+	if _, ok, err := store.Begin(ctx, "other", "", time.Minute); err != nil || !ok || len(table.rows) != 3 {
+		t.Fatalf("full batch should purge again on the next begin: %v %v %v left", ok, err, len(table.rows))
+	}
+
+	for i := 0; i < 2*purgeBatch+10; i++ {
+		table.rows[fmt.Sprint(i)] = record{expiresAt: millis(now)}
+	}
+	if n, err := store.Purge(ctx); err != nil || n != 2*purgeBatch+10 {
+		t.Fatalf("purge should delete every expired record: %v %v", n, err)
+	}
+	if _, ok := table.rows["live"]; !ok || len(table.rows) != 3 {
+		t.Fatalf("purge should keep live records: %v", table.rows)
+	}
+}
@@ -0,0 +1,22 @@
+// Package sweep schedules the removal of expired entries of in-memory stores
+package sweep
+
+import "time"
+
+// Interval is how often in-memory stores drop their expired entries
+const Interval = time.Minute
+
+// Schedule tracks when an in-memory store drops its expired entries next, the zero value is due right away.
+// It is not safe for concurrent use, stores call it with their lock held.
+type Schedule struct {
+	next time.Time
+}
+
+// Due reports whether expired entries are due to be dropped at now and schedules the next sweep after Interval
+func (s *Schedule) Due(now time.Time) bool {
+	if now.Before(s.next) {
+		return false
+	}
+	s.next = now.Add(Interval)
+	return true
+}
@@ -0,0 +1,21 @@
+package sweep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	var schedule Schedule
+	now := time.Unix(0, 0)
+
+	if !schedule.Due(now) {
+		t.Fatalf("first sweep should be due right away")
+	}
+	if schedule.Due(now.Add(Interval - time.Nanosecond)) {
+		t.Fatalf("sweep should not be due before the interval")
+	}
+	if !schedule.Due(now.Add(Interval)) {
+		t.Fatalf("sweep should be due after the interval")
+	}
+}
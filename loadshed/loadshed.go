@@ -0,0 +1,177 @@
+package loadshed
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/budhip/common/metrics"
+)
+
+// Priority is the lane of a call, lower value is more important
+type Priority int
+
+const (
+	// PriorityCritical calls are never shed, e.g. health checks and internal calls
+	PriorityCritical Priority = iota
+	// PriorityNormal calls are shed when the limit is reached
+	PriorityNormal
+	// PriorityLow calls are shed first, once the in-flight calls reach LowPriorityRatio of the limit
+	PriorityLow
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityCritical:
+		return "critical"
+	case PriorityNormal:
+		return "normal"
+	case PriorityLow:
+		return "low"
+	}
+	return strconv.Itoa(int(p))
+}
+
+// Config of AIMD limiter. The limit grows by one every limit calls completed under LatencyThreshold
+// and is multiplied by BackoffRatio when a call is slower or fails with an overload error. Calls started before
+// the last decrease do not decrease it again, so a burst of slow calls backs off once.
+type Config struct {
+	Name             string
+	InitialLimit     int
+	MinLimit         int
+	MaxLimit         int
+	LatencyThreshold time.Duration
+	BackoffRatio     float64
+	LowPriorityRatio float64
+}
+
+func (c Config) withDefaults() Config {
+	if c.MinLimit <= 0 {
+		c.MinLimit = 1
+	}
+	if c.MaxLimit <= 0 {
+		c.MaxLimit = 1000
+	}
+	if c.InitialLimit <= 0 {
+		c.InitialLimit = 20
+	}
+	if c.InitialLimit < c.MinLimit {
+		c.InitialLimit = c.MinLimit
+	}
+	if c.InitialLimit > c.MaxLimit {
+		c.InitialLimit = c.MaxLimit
+	}
+	if c.LatencyThreshold <= 0 {
+		c.LatencyThreshold = time.Second
+	}
+	if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+		c.BackoffRatio = 0.9
+	}
+	if c.LowPriorityRatio <= 0 || c.LowPriorityRatio > 1 {
+		c.LowPriorityRatio = 0.8
+	}
+	return c
+}
+
+// Limiter is an adaptive concurrency limiter using additive increase multiplicative decrease
+type Limiter struct {
+	mu       sync.Mutex
+	config   Config
+	limit    float64
+	inflight int
+	// generation counts decreases of the limit
+	generation uint64
+	now        func() time.Time
+
+	limitGauge    metrics.Gauge
+	inflightGauge metrics.Gauge
+}
+
+// NewLimiter returns AIMD limiter, zero values of config use defaults
+func NewLimiter(config Config) *Limiter {
+	config = config.withDefaults()
+	l := &Limiter{
+		config:        config,
+		limit:         float64(config.InitialLimit),
+		now:           time.Now,
+		limitGauge:    metrics.NewGauge("concurrency_limit", "name", config.Name),
+		inflightGauge: metrics.NewGauge("concurrency_inflight", "name", config.Name),
+	}
+	l.limitGauge.Set(l.limit)
+	return l
+}
+
+// Limit returns the current concurrency limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Token is a slot reserved by Acquire, it must be returned with Done or Release when the call completes
+type Token struct {
+	limiter    *Limiter
+	start      time.Time
+	generation uint64
+	once       sync.Once
+}
+
+// Done returns the slot and adjusts the limit by the call latency, overloaded reports a failure due to overload
+func (t *Token) Done(overloaded bool) {
+	t.once.Do(func() {
+		t.limiter.release(t, t.limiter.now().Sub(t.start), overloaded, true)
+	})
+}
+
+// Release returns the slot without adjusting the limit, e.g. for long-lived streams
+func (t *Token) Release() {
+	t.once.Do(func() {
+		t.limiter.release(t, 0, false, false)
+	})
+}
+
+// Acquire reserves a slot for a call of priority p, it returns false when the call must be shed
+func (l *Limiter) Acquire(p Priority) (*Token, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if p != PriorityCritical {
+		capacity := l.limit
+		if p >= PriorityLow {
+			capacity = math.Max(1, capacity*l.config.LowPriorityRatio)
+		}
+		if float64(l.inflight) >= capacity {
+			metrics.NewCounter("concurrency_rejected_total", "name", l.config.Name, "priority", p.String()).Add(1)
+			return nil, false
+		}
+	}
+
+	l.inflight++
+	l.inflightGauge.Set(float64(l.inflight))
+
+	return &Token{limiter: l, start: l.now(), generation: l.generation}, true
+}
+
+func (l *Limiter) release(t *Token, latency time.Duration, overloaded, adjust bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	l.inflightGauge.Set(float64(l.inflight))
+	if !adjust {
+		return
+	}
+
+	if overloaded || latency > l.config.LatencyThreshold {
+		if t.generation != l.generation {
+			// the limit already backed off for the calls in flight with this one
+			return
+		}
+		l.generation++
+		l.limit = math.Max(float64(l.config.MinLimit), l.limit*l.config.BackoffRatio)
+	} else {
+		l.limit = math.Min(float64(l.config.MaxLimit), l.limit+1/l.limit)
+	}
+	l.limitGauge.Set(l.limit)
+}
@@ -0,0 +1,52 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter(Config{Name: "test", InitialLimit: 10, MinLimit: 2, LatencyThreshold: 100 * time.Millisecond})
+	limiter.now = func() time.Time { return now }
+
+	var tokens []*Token
+	for i := 0; i < 10; i++ {
+		token, ok := limiter.Acquire(PriorityNormal)
+		if !ok {
+			t.Fatalf("call %d should be accepted", i)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if _, ok := limiter.Acquire(PriorityNormal); ok {
+		t.Fatalf("call over the limit should be shed")
+	}
+	if _, ok := limiter.Acquire(PriorityLow); ok {
+		t.Fatalf("low priority call should be shed")
+	}
+	critical, ok := limiter.Acquire(PriorityCritical)
+	if !ok {
+		t.Fatalf("critical call should never be shed")
+	}
+	critical.Done(false)
+
+	// slow calls decrease the limit
+	now = now.Add(time.Second)
+	for _, token := range tokens {
+		token.Done(false)
+	}
+	if got := limiter.Limit(); got != 9 {
+		t.Fatalf("burst of slow calls should decrease the limit once: %v", got)
+	}
+
+	// fast calls increase the limit again
+	before := limiter.Limit()
+	for i := 0; i < 100; i++ {
+		token, _ := limiter.Acquire(PriorityNormal)
+		token.Done(false)
+	}
+	if got := limiter.Limit(); got <= before {
+		t.Fatalf("limit should increase: %v", got)
+	}
+}
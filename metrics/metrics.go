@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+)
+
+// Counter is a metric that only goes up
+type Counter interface {
+	Add(delta float64)
+}
+
+// Gauge is a metric that can go up and down
+type Gauge interface {
+	Set(value float64)
+	Add(delta float64)
+}
+
+// Provider creates metrics, labels are given as key value pairs e.g. "method", "/user.User/Get"
+type Provider interface {
+	Counter(name string, labels ...string) Counter
+	Gauge(name string, labels ...string) Gauge
+}
+
+var (
+	mu       sync.RWMutex
+	provider Provider = &expvarProvider{vars: make(map[string]*expvar.Map)}
+)
+
+// SetProvider replaces the provider used by NewCounter and NewGauge, e.g. with a prometheus adapter
+func SetProvider(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	provider = p
+}
+
+// CurrentProvider returns the provider used by NewCounter and NewGauge, e.g. to restore it after SetProvider
+func CurrentProvider() Provider {
+	mu.RLock()
+	defer mu.RUnlock()
+	return provider
+}
+
+// NewCounter returns counter from current provider
+func NewCounter(name string, labels ...string) Counter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return provider.Counter(name, labels...)
+}
+
+// NewGauge returns gauge from current provider
+func NewGauge(name string, labels ...string) Gauge {
+	mu.RLock()
+	defer mu.RUnlock()
+	return provider.Gauge(name, labels...)
+}
+
+// expvarProvider publishes every metric as expvar map keyed by its labels, served on /debug/vars
+type expvarProvider struct {
+	mu   sync.Mutex
+	vars map[string]*expvar.Map
+}
+
+func (p *expvarProvider) metric(name string) *expvar.Map {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m, ok := p.vars[name]
+	if !ok {
+		if v, ok := expvar.Get(name).(*expvar.Map); ok {
+			m = v
+		} else {
+			m = expvar.NewMap(name)
+		}
+		p.vars[name] = m
+	}
+	return m
+}
+
+func labelKey(labels []string) string {
+	if len(labels) == 0 {
+		return "total"
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+labels[i+1])
+	}
+	return strings.Join(pairs, ",")
+}
+
+type expvarMetric struct {
+	m   *expvar.Map
+	key string
+}
+
+func (e expvarMetric) Add(delta float64) {
+	e.m.AddFloat(e.key, delta)
+}
+
+func (e expvarMetric) Set(value float64) {
+	e.m.AddFloat(e.key, 0)
+	if f, ok := e.m.Get(e.key).(*expvar.Float); ok {
+		f.Set(value)
+	}
+}
+
+func (p *expvarProvider) Counter(name string, labels ...string) Counter {
+	return expvarMetric{m: p.metric(name), key: labelKey(labels)}
+}
+
+func (p *expvarProvider) Gauge(name string, labels ...string) Gauge {
+	return expvarMetric{m: p.metric(name), key: labelKey(labels)}
+}
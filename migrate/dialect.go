@@ -0,0 +1,149 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// Dialect holds the statements and advisory lock of a database, applied_at is stored as unix milliseconds
+type Dialect struct {
+	createTable   string
+	tableExists   string
+	selectApplied string
+	insert        string
+	delete        string
+	lock          func(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error
+	unlock        func(ctx context.Context, conn *sql.Conn, name string) error
+	// split executes scripts statement by statement, for drivers that run one statement per call
+	split bool
+}
+
+// MySQL dialect, it locks with GET_LOCK. MySQL commits DDL implicitly so a failed migration
+// may be partially applied.
+var MySQL = Dialect{
+	createTable: `CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at BIGINT NOT NULL
+)`,
+	tableExists:   "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?",
+	selectApplied: "SELECT version, name, checksum, applied_at FROM %s ORDER BY version",
+	insert:        "INSERT INTO %s (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+	delete:        "DELETE FROM %s WHERE version = ?",
+	lock: func(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error {
+		var locked sql.NullInt64
+		err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(timeout.Seconds())).Scan(&locked)
+		if err != nil {
+			return err
+		}
+		if !locked.Valid || locked.Int64 != 1 {
+			return fmt.Errorf("migrate: lock %s not acquired within %s", name, timeout)
+		}
+		return nil
+	},
+	unlock: func(ctx context.Context, conn *sql.Conn, name string) error {
+		_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+		return err
+	},
+	split: true,
+}
+
+// Postgres dialect, it locks with pg_advisory_lock on the 64-bit FNV hash of the lock name.
+// Every migration runs in a transaction.
+var Postgres = Dialect{
+	createTable: `CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at BIGINT NOT NULL
+)`,
+	tableExists:   "SELECT to_regclass($1) IS NOT NULL",
+	selectApplied: "SELECT version, name, checksum, applied_at FROM %s ORDER BY version",
+	insert:        "INSERT INTO %s (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)",
+	delete:        "DELETE FROM %s WHERE version = $1",
+	lock: func(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey(name))
+		return err
+	},
+	unlock: func(ctx context.Context, conn *sql.Conn, name string) error {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey(name))
+		return err
+	},
+}
+
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func (d Dialect) statements(script string) []string {
+	if !d.split {
+		return []string{script}
+	}
+	return split(script)
+}
+
+// split splits script into statements on semicolons outside of quotes and comments, conditional comments and
+// optimizer hints are kept in their statement
+func split(script string) []string {
+	var statements []string
+	var current strings.Builder
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); len(statement) > 0 {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(script) && script[end] != c {
+				if script[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(script) {
+				end = len(script) - 1
+			}
+			current.WriteString(script[i : end+1])
+			i = end
+		case c == '-' && strings.HasPrefix(script[i:], "--"), c == '#':
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += end
+			current.WriteByte('\n')
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := len(script)
+			if n := strings.Index(script[i+2:], "*/"); n >= 0 {
+				end = i + n + 4
+			}
+			// MySQL runs the content of conditional comments /*! */ and reads optimizer hints /*+ */
+			if strings.HasPrefix(script[i:], "/*!") || strings.HasPrefix(script[i:], "/*+") {
+				current.WriteString(script[i:end])
+			}
+			i = end - 1
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+
+	return statements
+}
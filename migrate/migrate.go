@@ -0,0 +1,340 @@
+// Package migrate applies versioned SQL migrations to the databases returned by mysql.DB and postgre.DB.
+//
+// Migrations are files named <version>_<name>.up.sql with an optional <version>_<name>.down.sql, e.g.
+// 20220301120000_create_users.up.sql, read from an embed.FS or a directory with os.DirFS.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	fileName  = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ErrDrift is returned when applied migrations differ from the migration files
+var ErrDrift = errors.New("migrate: applied migrations drifted from files")
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the sha256 of Up, it detects files changed after they were applied
+	Checksum string
+}
+
+// Load reads migrations of directory dir of fsys sorted by version, use "." for the root of fsys
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid version of %s: %v", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d has names %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if len(m.Up) == 0 {
+			return nil, fmt.Errorf("migrate: version %d has no up migration", m.Version)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Applied is a migration recorded in the migration table
+type Applied struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Options configures a Migrator
+type Options struct {
+	// Table tracks applied migrations, defaults to schema_migrations
+	Table string
+	// LockName identifies the advisory lock, defaults to the table name
+	LockName string
+	// LockTimeout bounds waiting for the lock, defaults to 1 minute
+	LockTimeout time.Duration
+	// DryRun logs the migrations that would run without changing the database
+	DryRun bool
+}
+
+// Migrator applies migrations holding an advisory lock, so only one instance migrates at a time
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+	opts       Options
+}
+
+// New returns migrator of migrations loaded by Load
+func New(db *sql.DB, dialect Dialect, migrations []Migration, opts Options) (*Migrator, error) {
+	if len(opts.Table) == 0 {
+		opts.Table = "schema_migrations"
+	}
+	if !tableName.MatchString(opts.Table) {
+		return nil, fmt.Errorf("migrate: invalid table name %q", opts.Table)
+	}
+	if len(opts.LockName) == 0 {
+		opts.LockName = opts.Table
+	}
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = time.Minute
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations, opts: opts}, nil
+}
+
+func (m *Migrator) query(statement string) string {
+	return fmt.Sprintf(statement, m.opts.Table)
+}
+
+// withLock runs fn on a single connection holding the advisory lock, advisory locks belong to a session.
+// The migration table is created when create is set, read-only and dry runs leave the schema unchanged.
+func (m *Migrator) withLock(ctx context.Context, create bool, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := m.dialect.lock(ctx, conn, m.opts.LockName, m.opts.LockTimeout); err != nil {
+		return err
+	}
+	defer func() {
+		// the lock is released with the session if unlocking fails
+		if unlockErr := m.dialect.unlock(context.Background(), conn, m.opts.LockName); unlockErr != nil {
+			log.Printf("migrate: release lock %s: %v", m.opts.LockName, unlockErr)
+		}
+	}()
+
+	if create {
+		if _, err := conn.ExecContext(ctx, m.query(m.dialect.createTable)); err != nil {
+			return err
+		}
+	}
+	return fn(conn)
+}
+
+// applied returns the applied migrations, none when the migration table does not exist yet
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) ([]Applied, error) {
+	var exists bool
+	if err := conn.QueryRowContext(ctx, m.dialect.tableExists, m.opts.Table).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, m.query(m.dialect.selectApplied))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []Applied
+	for rows.Next() {
+		var a Applied
+		var appliedAt int64
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		a.AppliedAt = time.Unix(0, appliedAt*int64(time.Millisecond))
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// pending returns migrations not applied yet, it fails with ErrDrift when an applied migration
+// changed or its file is missing
+func pending(migrations []Migration, applied []Applied) ([]Migration, error) {
+	byVersion := make(map[int64]Migration, len(migrations))
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	done := make(map[int64]bool, len(applied))
+	for _, a := range applied {
+		migration, ok := byVersion[a.Version]
+		if !ok {
+			return nil, fmt.Errorf("%w: version %d %s is applied but has no file", ErrDrift, a.Version, a.Name)
+		}
+		if migration.Checksum != a.Checksum {
+			return nil, fmt.Errorf("%w: version %d %s changed after it was applied", ErrDrift, a.Version, a.Name)
+		}
+		done[a.Version] = true
+	}
+
+	var todo []Migration
+	for _, migration := range migrations {
+		if !done[migration.Version] {
+			todo = append(todo, migration)
+		}
+	}
+	return todo, nil
+}
+
+// Status returns the applied migrations, it fails with ErrDrift when they differ from the files
+func (m *Migrator) Status(ctx context.Context) (applied []Applied, pendingMigrations []Migration, err error) {
+	err = m.withLock(ctx, false, func(conn *sql.Conn) error {
+		if applied, err = m.applied(ctx, conn); err != nil {
+			return err
+		}
+		pendingMigrations, err = pending(m.migrations, applied)
+		return err
+	})
+	return applied, pendingMigrations, err
+}
+
+// Up applies every pending migration in version order and returns them, each in its own transaction
+// where the database supports it. It refuses to run when applied migrations drifted, see ErrDrift.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, !m.opts.DryRun, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		todo, err := pending(m.migrations, applied)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range todo {
+			if err := m.run(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations in reverse version order and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, false, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if _, err := pending(m.migrations, applied); err != nil {
+			return err
+		}
+
+		byVersion := make(map[int64]Migration, len(m.migrations))
+		for _, migration := range m.migrations {
+			byVersion[migration.Version] = migration
+		}
+
+		for i := len(applied) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := byVersion[applied[i].Version]
+			if len(migration.Down) == 0 {
+				return fmt.Errorf("migrate: version %d %s has no down migration", migration.Version, migration.Name)
+			}
+			if err := m.run(ctx, conn, migration, migration.Down, false); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// run executes script of migration and records it, up adds the migration and down removes it
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, script string, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+	if m.opts.DryRun {
+		log.Printf("migrate: dry run %s %d %s:\n%s", direction, migration.Version, migration.Name, script)
+		return nil
+	}
+
+	start := time.Now()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range m.dialect.statements(script) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migrate: %s %d %s: %w", direction, migration.Version, migration.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, m.query(m.dialect.insert), migration.Version, migration.Name, migration.Checksum,
+			time.Now().UnixNano()/int64(time.Millisecond))
+	} else {
+		_, err = tx.ExecContext(ctx, m.query(m.dialect.delete), migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("migrate: %s %d %s in %s", direction, migration.Version, migration.Name, time.Since(start))
+	return nil
+}
@@ -0,0 +1,295 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/2_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email TEXT;")},
+		"migrations/1_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id BIGINT);")},
+		"migrations/1_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations/README.md":               {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Load(fsys, "migrations")
+	if err != nil {
+		t.Fatalf("bad load: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Name != "add_email" {
+		t.Fatalf("bad migrations: %+v", migrations)
+	}
+	if migrations[0].Down != "DROP TABLE users;" || len(migrations[0].Checksum) != 64 {
+		t.Fatalf("bad migration: %+v", migrations[0])
+	}
+
+	fsys["migrations/3_orphan.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+	if _, err := Load(fsys, "migrations"); err == nil {
+		t.Fatalf("down migration without up should fail")
+	}
+}
+
+func TestPending(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "one", Checksum: "a"},
+		{Version: 2, Name: "two", Checksum: "b"},
+		{Version: 3, Name: "three", Checksum: "c"},
+	}
+
+	todo, err := pending(migrations, []Applied{{Version: 1, Checksum: "a"}, {Version: 3, Checksum: "c"}})
+	if err != nil || len(todo) != 1 || todo[0].Version != 2 {
+		t.Fatalf("bad pending migrations: %+v %v", todo, err)
+	}
+
+	if _, err := pending(migrations, []Applied{{Version: 1, Checksum: "changed"}}); !errors.Is(err, ErrDrift) {
+		t.Fatalf("changed migration should drift: %v", err)
+	}
+	if _, err := pending(migrations, []Applied{{Version: 4, Checksum: "d"}}); !errors.Is(err, ErrDrift) {
+		t.Fatalf("missing migration should drift: %v", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	script := `-- users; table
+CREATE TABLE users (id BIGINT, note TEXT DEFAULT 'a;b');
+/* seed; data */
+INSERT INTO users VALUES (1, 'it\'s;');
+/*!40101 SET NAMES utf8mb4 */;
+SELECT /*+ MAX_EXECUTION_TIME(1000) */ id FROM users;
+# trailing comment;
+`
+	want := []string{
+		"CREATE TABLE users (id BIGINT, note TEXT DEFAULT 'a;b')",
+		`INSERT INTO users VALUES (1, 'it\'s;')`,
+		"/*!40101 SET NAMES utf8mb4 */",
+		"SELECT /*+ MAX_EXECUTION_TIME(1000) */ id FROM users",
+	}
+	if got := split(script); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad statements: %q", got)
+	}
+}
+
+// migrateDriver records statements and keeps the migration table in memory
+type migrateDriver struct {
+	mu      sync.Mutex
+	log     []string
+	exists  bool
+	applied [][]driver.Value
+	locked  int64
+	// fail fails statements containing it
+	fail string
+}
+
+func (d *migrateDriver) statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	log := d.log
+	d.log = nil
+	return log
+}
+
+func (d *migrateDriver) Open(string) (driver.Conn, error) { return migrateConn{d: d}, nil }
+
+type migrateConn struct {
+	d *migrateDriver
+}
+
+func (migrateConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (migrateConn) Close() error                        { return nil }
+func (c migrateConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c migrateConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.record("BEGIN")
+	return c, nil
+}
+
+func (c migrateConn) Commit() error {
+	c.record("COMMIT")
+	return nil
+}
+
+func (c migrateConn) Rollback() error {
+	c.record("ROLLBACK")
+	return nil
+}
+
+// record logs the first line of query
+func (c migrateConn) record(query string) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.log = append(c.d.log, strings.SplitN(query, "\n", 2)[0])
+}
+
+func (c migrateConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(query)
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+
+	switch {
+	case len(c.d.fail) > 0 && strings.Contains(query, c.d.fail):
+		return nil, errors.New("syntax error")
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+		c.d.exists = true
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		row := make([]driver.Value, len(args))
+		for i, arg := range args {
+			row[i] = arg.Value
+		}
+		c.d.applied = append(c.d.applied, row)
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+		for i, row := range c.d.applied {
+			if row[0] == args[0].Value {
+				c.d.applied = append(c.d.applied[:i], c.d.applied[i+1:]...)
+				break
+			}
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c migrateConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.record(query)
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "SELECT GET_LOCK"):
+		return &rows{columns: []string{"locked"}, values: [][]driver.Value{{c.d.locked}}}, nil
+	case query == MySQL.tableExists:
+		exists := int64(0)
+		if c.d.exists {
+			exists = 1
+		}
+		return &rows{columns: []string{"count"}, values: [][]driver.Value{{exists}}}, nil
+	case strings.HasPrefix(query, "SELECT version"):
+		columns := []string{"version", "name", "checksum", "applied_at"}
+		return &rows{columns: columns, values: append([][]driver.Value{}, c.d.applied...)}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+type migrateConnector struct {
+	d *migrateDriver
+}
+
+func (c migrateConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c migrateConnector) Driver() driver.Driver                        { return c.d }
+
+func TestMigrator(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"1_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id BIGINT);")},
+		"1_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"2_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email TEXT;")},
+		"2_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email;")},
+	}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &migrateDriver{locked: 1}
+	db := sql.OpenDB(migrateConnector{d: d})
+	defer db.Close()
+
+	const (
+		lock    = "SELECT GET_LOCK(?, ?)"
+		unlock  = "SELECT RELEASE_LOCK(?)"
+		create  = "CREATE TABLE IF NOT EXISTS schema_migrations ("
+		applied = "SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version"
+		insert  = "INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"
+		remove  = "DELETE FROM schema_migrations WHERE version = ?"
+	)
+	exists := MySQL.tableExists
+	ctx := context.Background()
+
+	dryRun, err := New(db, MySQL, migrations, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done, err := dryRun.Up(ctx); err != nil || len(done) != 2 {
+		t.Fatalf("dry run should report both migrations: %v %v", done, err)
+	}
+	if got, want := d.statements(), []string{lock, exists, unlock}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("dry run should not change the schema:\n got %q\nwant %q", got, want)
+	}
+
+	m, err := New(db, MySQL, migrations, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, pendingMigrations, err := m.Status(ctx); err != nil || len(pendingMigrations) != 2 {
+		t.Fatalf("missing table should mean nothing applied: %v %v", pendingMigrations, err)
+	}
+	if got, want := d.statements(), []string{lock, exists, unlock}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("status should not change the schema:\n got %q\nwant %q", got, want)
+	}
+
+	if done, err := m.Up(ctx); err != nil || len(done) != 2 {
+		t.Fatalf("bad up: %v %v", done, err)
+	}
+	want := []string{
+		lock, create, exists, applied,
+		"BEGIN", "CREATE TABLE users (id BIGINT)", insert, "COMMIT",
+		"BEGIN", "ALTER TABLE users ADD email TEXT", insert, "COMMIT",
+		unlock,
+	}
+	if got := d.statements(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad up statements:\n got %q\nwant %q", got, want)
+	}
+
+	if done, err := m.Down(ctx, 1); err != nil || len(done) != 1 || done[0].Version != 2 {
+		t.Fatalf("bad down: %v %v", done, err)
+	}
+	want = []string{lock, exists, applied, "BEGIN", "ALTER TABLE users DROP email", remove, "COMMIT", unlock}
+	if got := d.statements(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad down statements:\n got %q\nwant %q", got, want)
+	}
+
+	d.fail = "ADD email"
+	if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Fatalf("failed migration should fail up, got %v", err)
+	}
+	want = []string{lock, create, exists, applied, "BEGIN", "ALTER TABLE users ADD email TEXT", "ROLLBACK", unlock}
+	if got := d.statements(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("failed migration should roll back without recording:\n got %q\nwant %q", got, want)
+	}
+	if len(d.applied) != 1 {
+		t.Fatalf("failed migration should not be recorded, applied %v", d.applied)
+	}
+
+	d.locked = 0
+	if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "not acquired") {
+		t.Fatalf("held lock should fail up, got %v", err)
+	}
+	if got := d.statements(); !reflect.DeepEqual(got, []string{lock}) {
+		t.Fatalf("lock not acquired should not run statements, got %q", got)
+	}
+}
@@ -1,28 +1,59 @@
 package mysql
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
 	"time"
 
+	"github.com/budhip/common/config"
+	"github.com/budhip/common/database"
+	"github.com/budhip/common/secrets"
 	"github.com/budhip/common/tls"
 	"github.com/go-sql-driver/mysql"
 )
 
+// Config of the MySQL connection, its tags load it with the config package
 type Config struct {
-	Host        string
-	Port        string
-	User        string
-	Password    string
-	Name        string
+	Host        string `required:"true"`
+	Port        string `default:"3306"`
+	User        string `required:"true"`
+	Password    string `secret:"true"`
+	Name        string `required:"true"`
 	MaxOpen     int
 	MaxIdle     int
 	MaxLifetime int // in minutes
 	CA          []byte
 	ParseTime   bool
 	Location    string
+	// PingTimeout bounds every ping of Connect, defaults to 5s
+	PingTimeout time.Duration
+	// ConnectAttempts is the maximum number of pings of Connect while the database is unreachable
+	ConnectAttempts int
+}
+
+// String returns config with the password redacted
+func (c Config) String() string {
+	return config.String(c)
+}
+
+// MySQL server error numbers of connection failures
+const (
+	errDBAccessDenied  = 1044
+	errAccessDenied    = 1045
+	errUnknownDatabase = 1049
+)
+
+// tlsConfigName returns the registered TLS config name of CA, databases of a cluster may use different CAs
+func tlsConfigName(ca []byte) string {
+	sum := sha256.Sum256(ca)
+	return "custom-" + hex.EncodeToString(sum[:8])
 }
 
 func dataSourceName(config Config) string {
@@ -36,7 +67,7 @@ func dataSourceName(config Config) string {
 		val.Add("loc", config.Location)
 	}
 	if config.CA != nil {
-		val.Add("tls", "custom")
+		val.Add("tls", tlsConfigName(config.CA))
 	}
 
 	if len(val) == 0 {
@@ -45,30 +76,109 @@ func dataSourceName(config Config) string {
 	return fmt.Sprintf("%s?%s", connection, val.Encode())
 }
 
+func registerTLS(config Config) error {
+	if config.CA == nil {
+		return nil
+	}
+
+	tlsCfg, err := tls.NewCA(config.CA)
+	if err != nil {
+		return err
+	}
+	if err := mysql.RegisterTLSConfig(tlsConfigName(config.CA), tlsCfg); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func limits(config Config) database.Limits {
+	return database.Limits{
+		MaxOpen:     config.MaxOpen,
+		MaxIdle:     config.MaxIdle,
+		MaxLifetime: time.Duration(config.MaxLifetime) * time.Minute,
+	}
+}
+
 // DB return new sql db
 func DB(config Config) (*sql.DB, error) {
-	if config.CA != nil {
-		if err := mysql.RegisterTLSConfig("custom", tls.WithCA(config.CA)); err != nil {
-			log.Println(err)
-			return nil, err
-		}
+	if err := registerTLS(config); err != nil {
+		return nil, err
 	}
 
 	db, err := sql.Open("mysql", dataSourceName(config))
 	if err != nil {
 		return nil, err
 	}
+	database.SetLimits(db, limits(config))
+
+	return db, nil
+}
 
-	if config.MaxOpen > 0 {
-		db.SetMaxOpenConns(config.MaxOpen)
+// DBWithSecret returns new sql db like DB whose connections authenticate with the current value of secret
+// secretName of provider instead of Password. New connections use a rotated password and idle connections are
+// closed when the rotation is noticed, MaxLifetime bounds how long connections in use keep the old one.
+func DBWithSecret(config Config, provider secrets.Provider, secretName string) (*sql.DB, error) {
+	if err := registerTLS(config); err != nil {
+		return nil, err
 	}
-	if config.MaxIdle > 0 {
-		db.SetMaxIdleConns(config.MaxIdle)
+
+	config.Password = ""
+	mysqlCfg, err := mysql.ParseDSN(dataSourceName(config))
+	if err != nil {
+		return nil, err
 	}
-	if config.MaxLifetime > 0 {
-		db.SetConnMaxLifetime(time.Duration(config.MaxLifetime) * time.Minute)
+
+	open := func(password string) (driver.Connector, error) {
+		cfg := mysqlCfg.Clone()
+		cfg.Passwd = password
+		return mysql.NewConnector(cfg)
+	}
+	return database.OpenWithSecret(mysql.MySQLDriver{}, provider, secretName, open, limits(config)), nil
+}
+
+// classify returns the kind of connection failure of MySQL errors
+func classify(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		if errors.Is(err, mysql.ErrInvalidConn) {
+			return database.ErrUnreachable
+		}
+		return nil
+	}
+
+	switch mysqlErr.Number {
+	case errAccessDenied, errDBAccessDenied:
+		return database.ErrAuth
+	case errUnknownDatabase:
+		return database.ErrUnknownDatabase
+	}
+	return nil
+}
+
+// Connect returns new sql db like DB and verifies the connection, it retries while the database is unreachable
+// up to ConnectAttempts. Failures are database.ConnectError, e.g. errors.Is(err, database.ErrAuth).
+func Connect(ctx context.Context, config Config) (*sql.DB, error) {
+	db, err := DB(config)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := database.VerifyOptions{Timeout: config.PingTimeout, Attempts: config.ConnectAttempts}
+	if err := database.Verify(ctx, db, opts, classify); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return db, nil
 }
 
+// Cluster returns database cluster routing writes to primary and reads to healthy replicas
+func Cluster(primary Config, replicas []Config, config database.ClusterConfig) (*database.Cluster, error) {
+	var replicaDBs []func() (*sql.DB, error)
+	for _, replica := range replicas {
+		replica := replica
+		replicaDBs = append(replicaDBs, func() (*sql.DB, error) { return DB(replica) })
+	}
+	return database.OpenCluster(func() (*sql.DB, error) { return DB(primary) }, replicaDBs, config)
+}
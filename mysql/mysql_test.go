@@ -1,8 +1,19 @@
-package mysql_test
+package mysql
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/budhip/common/config"
+	"github.com/budhip/common/database"
+	"github.com/budhip/common/secrets"
+	"github.com/go-sql-driver/mysql"
 )
 
 func ca() []byte {
@@ -50,3 +61,73 @@ func TestDB(t *testing.T) {
 	}
 }
 
+func TestLoadConfig(t *testing.T) {
+	os.Setenv("ORDERS_HOST", "localhost")
+	os.Setenv("ORDERS_USER", "orders")
+	os.Setenv("ORDERS_PASSWORD", "hunter2")
+	os.Setenv("ORDERS_NAME", "orders")
+	os.Setenv("ORDERS_PING_TIMEOUT", "2s")
+	defer func() {
+		for _, name := range []string{"HOST", "USER", "PASSWORD", "NAME", "PING_TIMEOUT"} {
+			os.Unsetenv("ORDERS_" + name)
+		}
+	}()
+
+	var cfg Config
+	if err := config.Load(&cfg, config.WithEnv("ORDERS")); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "3306" || cfg.Password != "hunter2" || cfg.PingTimeout != 2*time.Second {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if strings.Contains(fmt.Sprint(cfg), "hunter2") {
+		t.Fatalf("password should be redacted when printed")
+	}
+}
+
+func TestConnect(t *testing.T) {
+	config := Config{
+		Host:            "127.0.0.1",
+		Port:            "1",
+		User:            "test",
+		Password:        "test",
+		Name:            "test",
+		PingTimeout:     time.Second,
+		ConnectAttempts: 2,
+	}
+
+	if _, err := Connect(context.Background(), config); !errors.Is(err, database.ErrUnreachable) {
+		t.Fatalf("expected unreachable, got %v", err)
+	}
+}
+
+func TestDBWithSecret(t *testing.T) {
+	config := Config{Host: "127.0.0.1", Port: "1", User: "test", Name: "test"}
+
+	db, err := DBWithSecret(config, secrets.Env{Prefix: "TEST_"}, "missing-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(context.Background()); !errors.Is(err, secrets.ErrNotFound) {
+		t.Fatalf("connections should look up the password, got %v", err)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{err: &mysql.MySQLError{Number: 1045, Message: "Access denied"}, kind: database.ErrAuth},
+		{err: &mysql.MySQLError{Number: 1049, Message: "Unknown database"}, kind: database.ErrUnknownDatabase},
+		{err: &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, kind: nil},
+	}
+
+	for _, tt := range tests {
+		if got := classify(tt.err); got != tt.kind {
+			t.Fatalf("bad kind of %v: %v", tt.err, got)
+		}
+	}
+}
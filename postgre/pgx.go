@@ -0,0 +1,146 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/budhip/common/database"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// Pool returns native pgx pool for code that does not need database/sql, e.g. for COPY and batches.
+// MaxOpen and the lifetimes of config size the pool like DB does. pgxpool has no idle cap, so MaxIdle is
+// ignored and idle connections are closed after MaxIdleTime.
+func Pool(ctx context.Context, config Config) (*pgxpool.Pool, error) {
+	if err := validate(config); err != nil {
+		return nil, err
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(dataSourceName(config))
+	if err != nil {
+		return nil, err
+	}
+	if poolConfig.ConnConfig.TLSConfig, err = tlsConfig(config); err != nil {
+		return nil, err
+	}
+
+	if config.MaxOpen > 0 {
+		poolConfig.MaxConns = int32(config.MaxOpen)
+	}
+	if config.MaxLifetime > 0 {
+		poolConfig.MaxConnLifetime = time.Duration(config.MaxLifetime) * time.Minute
+	}
+	if config.MaxIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = time.Duration(config.MaxIdleTime) * time.Minute
+	}
+
+	return pgxpool.ConnectConfig(ctx, poolConfig)
+}
+
+// Conn calls fn with the native pgx connection of a connection of db, db must be opened by DB.
+// The connection is returned to db when fn returns and must not be used after.
+func Conn(db *sql.DB, fn func(conn *pgx.Conn) error) error {
+	conn, err := stdlib.AcquireConn(db)
+	if err != nil {
+		return err
+	}
+	defer stdlib.ReleaseConn(db, conn)
+
+	return fn(conn)
+}
+
+// Notification is a message sent by NOTIFY
+type Notification struct {
+	PID     uint32
+	Channel string
+	Payload string
+}
+
+// Listener receives notifications of channels on a dedicated connection of db
+type Listener struct {
+	db   *sql.DB
+	conn *pgx.Conn
+}
+
+// Listen takes a connection of db out of the pool and listens to channels on it, Close returns it.
+// db must be opened by DB.
+func Listen(ctx context.Context, db *sql.DB, channels ...string) (*Listener, error) {
+	conn, err := stdlib.AcquireConn(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, channel := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			_ = stdlib.ReleaseConn(db, conn)
+			return nil, err
+		}
+	}
+
+	return &Listener{db: db, conn: conn}, nil
+}
+
+// Wait blocks until a notification arrives or ctx is done
+func (l *Listener) Wait(ctx context.Context) (Notification, error) {
+	n, err := l.conn.WaitForNotification(ctx)
+	if err != nil {
+		return Notification{}, err
+	}
+	return Notification{PID: n.PID, Channel: n.Channel, Payload: n.Payload}, nil
+}
+
+// Close stops listening and returns the connection to db
+func (l *Listener) Close(ctx context.Context) error {
+	if _, err := l.conn.Exec(ctx, "UNLISTEN *"); err != nil {
+		// the connection state is unknown, do not hand it to other callers
+		_ = l.conn.Close(ctx)
+	}
+	return stdlib.ReleaseConn(l.db, l.conn)
+}
+
+// Notify sends payload to listeners of channel, it is delivered when the current transaction commits
+func Notify(ctx context.Context, db *sql.DB, channel, payload string) error {
+	_, err := db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+// classify returns the kind of connection failure of postgres errors,
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html
+func classify(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+
+	switch pgErr.Code {
+	case "28000", "28P01": // invalid_authorization_specification, invalid_password
+		return database.ErrAuth
+	case "3D000": // invalid_catalog_name
+		return database.ErrUnknownDatabase
+	case "57P03", "53300": // cannot_connect_now while starting up, too_many_connections
+		return database.ErrUnreachable
+	}
+	return nil
+}
+
+// Connect returns new sql db like DB and verifies the connection, it retries while the database is unreachable
+// up to ConnectAttempts. Failures are database.ConnectError, e.g. errors.Is(err, database.ErrAuth).
+func Connect(ctx context.Context, config Config) (*sql.DB, error) {
+	db, err := DB(config)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := database.VerifyOptions{Timeout: config.PingTimeout, Attempts: config.ConnectAttempts}
+	if err := database.Verify(ctx, db, opts, classify); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
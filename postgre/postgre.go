@@ -1,30 +1,261 @@
 package postgre
 
 import (
+	cryptotls "crypto/tls"
+	"crypto/x509"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/budhip/common/config"
+	"github.com/budhip/common/database"
+	"github.com/budhip/common/secrets"
+	"github.com/budhip/common/tls"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// SSL modes, see https://www.postgresql.org/docs/current/libpq-ssl.html#LIBPQ-SSL-PROTECTION
+const (
+	SSLDisable    = "disable"
+	SSLRequire    = "require"
+	SSLVerifyCA   = "verify-ca"
+	SSLVerifyFull = "verify-full"
 )
 
+// Config of the postgres connection, its tags load it with the config package
 type Config struct {
-	Host        string
-	Port        string
-	User        string
-	Password    string
-	Name        string
+	Host        string `required:"true"`
+	Port        string `default:"5432"`
+	User        string `required:"true"`
+	Password    string `secret:"true"`
+	Name        string `required:"true"`
+	MaxOpen     int
+	MaxIdle     int
+	MaxLifetime int // in minutes
+	MaxIdleTime int // in minutes
+	// SSLMode defaults to verify-full when CA is set, disable otherwise
+	SSLMode string
+	CA      []byte
+	// Cert and Key are the client certificate
+	Cert             []byte
+	Key              []byte `secret:"true"`
+	ConnectTimeout   int    // in seconds
+	StatementTimeout int    // in milliseconds
+	SearchPath       string
+	ApplicationName  string
+	// PingTimeout bounds every ping of Connect, defaults to 5s
+	PingTimeout time.Duration
+	// ConnectAttempts is the maximum number of pings of Connect while the database is unreachable
+	ConnectAttempts int
+}
+
+// String returns config with the password and client key redacted
+func (c Config) String() string {
+	return config.String(c)
 }
 
+// Validate checks SSL mode and certificate material
+func (c Config) Validate() error {
+	return validate(c)
+}
+
+func sslMode(config Config) string {
+	if len(config.SSLMode) > 0 {
+		return config.SSLMode
+	}
+	if config.CA != nil {
+		return SSLVerifyFull
+	}
+	return SSLDisable
+}
+
+// quote quotes value of keyword/value connection string, escaping backslash and single quote
+func quote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// dataSourceName returns keyword/value connection string. TLS is not part of it, tlsConfig builds it
+// from the in-memory certificate material and it is set on the connection config instead.
 func dataSourceName(config Config) string {
-	connection := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", config.Host, config.Port, config.User, config.Password, config.Name)
+	params := [][2]string{
+		{"host", config.Host},
+		{"port", config.Port},
+		{"user", config.User},
+		{"password", config.Password},
+		{"dbname", config.Name},
+		{"sslmode", SSLDisable},
+	}
+	if config.ConnectTimeout > 0 {
+		params = append(params, [2]string{"connect_timeout", strconv.Itoa(config.ConnectTimeout)})
+	}
+	if config.StatementTimeout > 0 {
+		params = append(params, [2]string{"statement_timeout", strconv.Itoa(config.StatementTimeout)})
+	}
+	params = append(params,
+		[2]string{"search_path", config.SearchPath},
+		[2]string{"application_name", config.ApplicationName},
+	)
+
+	var connection []string
+	for _, param := range params {
+		if len(param[1]) == 0 {
+			continue
+		}
+		connection = append(connection, fmt.Sprintf("%s=%s", param[0], quote(param[1])))
+	}
 
-	return fmt.Sprintf("%s", connection)
+	return strings.Join(connection, " ")
 }
 
-// DB return new sql db
+// validate checks SSL mode and certificate material
+func validate(config Config) error {
+	switch mode := sslMode(config); mode {
+	case SSLDisable, SSLRequire:
+	case SSLVerifyCA, SSLVerifyFull:
+		if config.CA == nil {
+			return fmt.Errorf("postgre: sslmode %s requires CA", mode)
+		}
+	default:
+		return fmt.Errorf("postgre: unknown sslmode %q", mode)
+	}
+
+	if config.CA != nil {
+		if _, _, err := tls.ParseCA(config.CA); err != nil {
+			return err
+		}
+	}
+	if config.Cert != nil || config.Key != nil {
+		if _, _, err := tls.ParseKeyPair(config.Cert, config.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tlsConfig returns TLS config of sslmode like libpq does: require only encrypts unless CA is set,
+// verify-ca verifies the server certificate chain and verify-full also the host name
+func tlsConfig(config Config) (*cryptotls.Config, error) {
+	mode := sslMode(config)
+	if mode == SSLDisable {
+		return nil, nil
+	}
+
+	opts := []tls.Option{tls.WithServerName(config.Host)}
+	if config.CA != nil {
+		opts = append(opts, tls.WithRootCAs(config.CA))
+	}
+	if config.Cert != nil || config.Key != nil {
+		opts = append(opts, tls.WithKeyPair(config.Cert, config.Key))
+	}
+	tlsCfg, err := tls.NewConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == SSLVerifyFull {
+		return tlsCfg, nil
+	}
+	// the static check verifies host name too, require and verify-ca verify the chain only
+	tlsCfg.InsecureSkipVerify = true
+	if tlsCfg.RootCAs != nil {
+		tlsCfg.VerifyPeerCertificate = verifyChain(tlsCfg.RootCAs)
+	}
+	return tlsCfg, nil
+}
+
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("postgre: no server certificate")
+		}
+
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		var leaf *x509.Certificate
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				leaf = cert
+				continue
+			}
+			opts.Intermediates.AddCert(cert)
+		}
+
+		_, err := leaf.Verify(opts)
+		return err
+	}
+}
+
+// ConnConfig returns pgx connection config with TLS and session parameters of config
+func ConnConfig(config Config) (*pgx.ConnConfig, error) {
+	if err := validate(config); err != nil {
+		return nil, err
+	}
+
+	connConfig, err := pgx.ParseConfig(dataSourceName(config))
+	if err != nil {
+		return nil, err
+	}
+	if connConfig.TLSConfig, err = tlsConfig(config); err != nil {
+		return nil, err
+	}
+
+	return connConfig, nil
+}
+
+func limits(config Config) database.Limits {
+	return database.Limits{
+		MaxOpen:     config.MaxOpen,
+		MaxIdle:     config.MaxIdle,
+		MaxLifetime: time.Duration(config.MaxLifetime) * time.Minute,
+		MaxIdleTime: time.Duration(config.MaxIdleTime) * time.Minute,
+	}
+}
+
+// DB return new sql db using the pgx driver, see Conn for pgx specific features
 func DB(config Config) (*sql.DB, error) {
-	db, err := sql.Open("postgres", dataSourceName(config))
+	connConfig, err := ConnConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
+	db := stdlib.OpenDB(*connConfig)
+	database.SetLimits(db, limits(config))
+
 	return db, nil
-}
\ No newline at end of file
+}
+
+// DBWithSecret returns new sql db like DB whose connections authenticate with the current value of secret
+// secretName of provider instead of Password. New connections use a rotated password and idle connections are
+// closed when the rotation is noticed, MaxLifetime bounds how long connections in use keep the old one.
+func DBWithSecret(config Config, provider secrets.Provider, secretName string) (*sql.DB, error) {
+	config.Password = ""
+	connConfig, err := ConnConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	open := func(password string) (driver.Connector, error) {
+		cfg := connConfig.Copy()
+		cfg.Password = password
+		return stdlib.GetConnector(*cfg), nil
+	}
+	return database.OpenWithSecret(stdlib.GetDefaultDriver(), provider, secretName, open, limits(config)), nil
+}
+
+// Cluster returns database cluster routing writes to primary and reads to healthy replicas
+func Cluster(primary Config, replicas []Config, config database.ClusterConfig) (*database.Cluster, error) {
+	var replicaDBs []func() (*sql.DB, error)
+	for _, replica := range replicas {
+		replica := replica
+		replicaDBs = append(replicaDBs, func() (*sql.DB, error) { return DB(replica) })
+	}
+	return database.OpenCluster(func() (*sql.DB, error) { return DB(primary) }, replicaDBs, config)
+}
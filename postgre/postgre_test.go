@@ -0,0 +1,166 @@
+package postgre
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/budhip/common/database"
+	"github.com/budhip/common/secrets"
+	"github.com/budhip/common/tls/tlstest"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+func TestDataSourceName(t *testing.T) {
+	config := Config{
+		Host:             "localhost",
+		Port:             "5432",
+		User:             "test",
+		Password:         `p@ss 'word\`,
+		Name:             "test",
+		ConnectTimeout:   5,
+		StatementTimeout: 30000,
+		SearchPath:       "app,public",
+		ApplicationName:  "common test",
+	}
+
+	want := `host='localhost' port='5432' user='test' password='p@ss \'word\\' dbname='test' sslmode='disable' ` +
+		`connect_timeout='5' statement_timeout='30000' search_path='app,public' ` +
+		`application_name='common test'`
+	if got := dataSourceName(config); got != want {
+		t.Fatalf("bad data source name: %v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ca.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config Config
+		valid  bool
+	}{
+		{config: Config{}, valid: true},
+		{config: Config{CA: ca.CertPEM, Cert: client.CertPEM, Key: client.KeyPEM}, valid: true},
+		{config: Config{SSLMode: SSLVerifyCA}, valid: false},
+		{config: Config{SSLMode: "prefer"}, valid: false},
+		{config: Config{CA: []byte("invalid")}, valid: false},
+		{config: Config{SSLMode: SSLRequire, Cert: client.CertPEM}, valid: false},
+	}
+
+	for i, tt := range tests {
+		if err := validate(tt.config); (err == nil) != tt.valid {
+			t.Fatalf("bad validation of config %d: %v", i, err)
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca, _ := tlstest.NewCA()
+	server, _ := ca.Server()
+	other, _ := tlstest.NewCA()
+	untrusted, _ := other.Server()
+
+	if cfg, err := tlsConfig(Config{}); err != nil || cfg != nil {
+		t.Fatalf("sslmode disable should not use TLS: %v %v", cfg, err)
+	}
+
+	cfg, err := tlsConfig(Config{Host: "db.internal", SSLMode: SSLRequire})
+	if err != nil || !cfg.InsecureSkipVerify || cfg.VerifyPeerCertificate != nil {
+		t.Fatalf("sslmode require should only encrypt: %v", err)
+	}
+
+	cfg, err = tlsConfig(Config{Host: "db.internal", SSLMode: SSLVerifyCA, CA: ca.CertPEM})
+	if err != nil {
+		t.Fatalf("bad tls config: %v", err)
+	}
+	if err := cfg.VerifyPeerCertificate([][]byte{server.Cert.Raw}, nil); err != nil {
+		t.Fatalf("sslmode verify-ca should not verify host name: %v", err)
+	}
+	if err := cfg.VerifyPeerCertificate([][]byte{untrusted.Cert.Raw}, nil); err == nil {
+		t.Fatalf("sslmode verify-ca should verify the chain")
+	}
+
+	cfg, err = tlsConfig(Config{Host: "db.internal", CA: ca.CertPEM})
+	if err != nil || cfg.InsecureSkipVerify || cfg.ServerName != "db.internal" {
+		t.Fatalf("sslmode verify-full should verify host name: %v", err)
+	}
+}
+
+func TestDB(t *testing.T) {
+	config := Config{
+		Host:        "localhost",
+		Port:        "5432",
+		User:        "test",
+		Password:    "test",
+		Name:        "test",
+		MaxOpen:     10,
+		MaxIdle:     3,
+		MaxLifetime: 60,
+	}
+
+	db, err := DB(config)
+	if err != nil {
+		t.Fatalf("bad config: %v", err)
+	}
+	defer db.Close()
+	if _, ok := db.Driver().(*stdlib.Driver); !ok {
+		t.Fatalf("bad driver: %T", db.Driver())
+	}
+}
+
+func TestConnect(t *testing.T) {
+	config := Config{
+		Host:            "127.0.0.1",
+		Port:            "1",
+		User:            "test",
+		Password:        "test",
+		Name:            "test",
+		PingTimeout:     time.Second,
+		ConnectAttempts: 2,
+	}
+
+	if _, err := Connect(context.Background(), config); !errors.Is(err, database.ErrUnreachable) {
+		t.Fatalf("expected unreachable, got %v", err)
+	}
+}
+
+func TestDBWithSecret(t *testing.T) {
+	config := Config{Host: "127.0.0.1", Port: "1", User: "test", Name: "test"}
+
+	db, err := DBWithSecret(config, secrets.Env{Prefix: "TEST_"}, "missing-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(context.Background()); !errors.Is(err, secrets.ErrNotFound) {
+		t.Fatalf("connections should look up the password, got %v", err)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		code string
+		kind error
+	}{
+		{code: "28P01", kind: database.ErrAuth},
+		{code: "3D000", kind: database.ErrUnknownDatabase},
+		{code: "57P03", kind: database.ErrUnreachable},
+		{code: "23505", kind: nil},
+	}
+
+	for _, tt := range tests {
+		if got := classify(&pgconn.PgError{Code: tt.code}); got != tt.kind {
+			t.Fatalf("bad kind of %s: %v", tt.code, got)
+		}
+	}
+}
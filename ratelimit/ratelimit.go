@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests calls per Period. Burst is the bucket size of token bucket limiter, it defaults to Requests.
+// A limit without Requests or Period is unlimited.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Result is the decision of a limiter
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// unlimited reports whether l allows every call
+func (l Limit) unlimited() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+// Limiter decides whether a call identified by key is allowed under limit
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// HashKey returns a truncated SHA-256 of secret, limiter keys of secrets such as API keys must not expose them
+// in memory dumps or Redis
+func HashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:16])
+}
+
+var periods = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// ParseLimit parses limit such as "100/1m", "10/s" or "1000/1h", the format used in remote config
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: expected <requests>/<period>", s)
+	}
+
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad requests", s)
+	}
+
+	period, ok := periods[parts[1]]
+	if !ok {
+		period, err = time.ParseDuration(parts[1])
+		if err != nil || period <= 0 {
+			return Limit{}, fmt.Errorf("invalid rate limit %q: bad period", s)
+		}
+	}
+
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+// String returns limit in the format of ParseLimit, e.g. "100/m" or "10/30s", and empty when it is unlimited.
+// Burst is not part of the format.
+func (l Limit) String() string {
+	if l.unlimited() {
+		return ""
+	}
+	for unit, period := range periods {
+		if l.Period == period {
+			return strconv.Itoa(l.Requests) + "/" + unit
+		}
+	}
+	return strconv.Itoa(l.Requests) + "/" + l.Period.String()
+}
+
+// MarshalText returns limit text like String
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText parses limit text like ParseLimit, e.g. to load limits with the config package.
+// Empty text is the unlimited zero limit.
+func (l *Limit) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*l = Limit{}
+		return nil
+	}
+	limit, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = limit
+	return nil
+}
+
+// Limits holds the limit of every method or path, it can be updated at runtime e.g. from remote config
+type Limits struct {
+	mu     sync.RWMutex
+	def    *Limit
+	limits map[string]Limit
+}
+
+// NewLimits returns limits, def is used for keys without their own limit and nil means unlimited
+func NewLimits(def *Limit, limits map[string]Limit) *Limits {
+	l := &Limits{}
+	l.Update(def, limits)
+	return l
+}
+
+// Update replaces every limit
+func (l *Limits) Update(def *Limit, limits map[string]Limit) {
+	copied := make(map[string]Limit, len(limits))
+	for k, v := range limits {
+		copied[k] = v
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.def = def
+	l.limits = copied
+}
+
+// Get returns limit of name, false means unlimited
+func (l *Limits) Get(name string) (Limit, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if limit, ok := l.limits[name]; ok {
+		return limit, true
+	}
+	if l.def != nil {
+		return *l.def, true
+	}
+	return Limit{}, false
+}
+
+// ParseLimits parses limits keyed by method or path, e.g. remote config parameters
+func ParseLimits(values map[string]string) (map[string]Limit, error) {
+	limits := make(map[string]Limit, len(values))
+	for k, v := range values {
+		limit, err := ParseLimit(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		limits[k] = limit
+	}
+	return limits, nil
+}
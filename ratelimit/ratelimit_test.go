@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/budhip/common/internal/sweep"
+)
+
+// fakeRedis is an in-process RedisClient, Eval runs the script of RedisStore.Incr
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]int64
+	ttls   map[string]int64
+}
+
+func (f *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if script != incrScript {
+		return nil, fmt.Errorf("unexpected script %q", script)
+	}
+	key := keys[0]
+	f.values[key] += args[0].(int64)
+	if _, ok := f.ttls[key]; !ok {
+		f.ttls[key] = args[1].(int64)
+	}
+	return f.values[key], nil
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.values[key]
+	if !ok {
+		return "", nil
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Limit
+		ok   bool
+	}{
+		{in: "100/1m", want: Limit{Requests: 100, Period: time.Minute}, ok: true},
+		{in: "10/s", want: Limit{Requests: 10, Period: time.Second}, ok: true},
+		{in: "10", ok: false},
+		{in: "x/s", ok: false},
+		{in: "0/s", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Fatalf("bad limit %v: %v %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestLimitText(t *testing.T) {
+	for _, text := range []string{"100/m", "10/s", "5/30s", ""} {
+		var limit Limit
+		if err := limit.UnmarshalText([]byte(text)); err != nil {
+			t.Fatalf("bad limit %q: %v", text, err)
+		}
+		if got, _ := limit.MarshalText(); string(got) != text {
+			t.Fatalf("limit %q should round trip, got %q", text, got)
+		}
+	}
+	if got := (Limit{Requests: 100, Period: time.Minute, Burst: 200}).String(); got != "100/m" {
+		t.Fatalf("bad string: %q", got)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewTokenBucket()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: time.Second}
+
+	for i := 0; i < 2; i++ {
+		if res, _ := limiter.Allow(context.Background(), "key", limit); !res.Allowed {
+			t.Fatalf("call %d should be allowed", i)
+		}
+	}
+
+	res, _ := limiter.Allow(context.Background(), "key", limit)
+	if res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("bad result: %+v", res)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if res, _ := limiter.Allow(context.Background(), "key", limit); !res.Allowed {
+		t.Fatalf("call should be allowed after refill: %+v", res)
+	}
+
+	if res, _ := limiter.Allow(context.Background(), "key", Limit{}); !res.Allowed {
+		t.Fatalf("zero limit should be unlimited: %+v", res)
+	}
+}
+
+func TestTokenBucketEvict(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewTokenBucket()
+	limiter.now = func() time.Time { return now }
+	hourly := Limit{Requests: 1, Period: time.Hour}
+
+	if res, _ := limiter.Allow(context.Background(), "hourly", hourly); !res.Allowed {
+		t.Fatalf("first call should be allowed: %+v", res)
+	}
+	for i := 0; i < 10; i++ {
+		limiter.Allow(context.Background(), strconv.Itoa(i), Limit{Requests: 1, Period: time.Second})
+	}
+
+	// the next sweep drops the refilled short lived buckets, the hourly bucket is not refilled yet
+	now = now.Add(sweep.Interval)
+	if res, _ := limiter.Allow(context.Background(), "hourly", hourly); res.Allowed {
+		t.Fatalf("bucket should not be evicted before its own period: %+v", res)
+	}
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("refilled buckets should be evicted: %v left", len(limiter.buckets))
+	}
+}
+
+func TestMemoryStoreEvict(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		store.Incr(ctx, strconv.Itoa(i), 1, time.Second)
+	}
+	store.Incr(ctx, "hourly", 1, time.Hour)
+
+	now = now.Add(sweep.Interval)
+	if value, _ := store.Incr(ctx, "hourly", 1, time.Hour); value != 2 {
+		t.Fatalf("counter should not be evicted before it expires: %v", value)
+	}
+	if len(store.counters) != 1 {
+		t.Fatalf("expired counters should be evicted: %v left", len(store.counters))
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"redis":  NewRedisStore(&fakeRedis{values: make(map[string]int64), ttls: make(map[string]int64)}, "ratelimit:"),
+	}
+
+	for name, store := range stores {
+		now := time.Unix(60, 0)
+		limiter := NewSlidingWindow(store)
+		limiter.now = func() time.Time { return now }
+		limit := Limit{Requests: 3, Period: time.Minute}
+
+		for i := 0; i < 3; i++ {
+			if res, _ := limiter.Allow(context.Background(), "key", limit); !res.Allowed {
+				t.Fatalf("%s: call %d should be allowed", name, i)
+			}
+		}
+		if res, _ := limiter.Allow(context.Background(), "key", limit); res.Allowed || res.RetryAfter <= 0 {
+			t.Fatalf("%s: bad result: %+v", name, res)
+		}
+
+		// half of the previous window still counts
+		now = now.Add(90 * time.Second)
+		if res, _ := limiter.Allow(context.Background(), "key", limit); !res.Allowed {
+			t.Fatalf("%s: call should be allowed: %+v", name, res)
+		}
+		if res, _ := limiter.Allow(context.Background(), "key", limit); res.Allowed {
+			t.Fatalf("%s: call should be limited: %+v", name, res)
+		}
+		if res, _ := limiter.Allow(context.Background(), "key", Limit{Requests: 3}); !res.Allowed {
+			t.Fatalf("%s: limit without period should be unlimited: %+v", name, res)
+		}
+	}
+}
+
+func TestRedisStoreTTL(t *testing.T) {
+	client := &fakeRedis{values: map[string]int64{"ratelimit:stale": 5}, ttls: make(map[string]int64)}
+	store := NewRedisStore(client, "ratelimit:")
+
+	if value, err := store.Incr(context.Background(), "key", 2, time.Minute); err != nil || value != 2 {
+		t.Fatalf("bad counter: %v %v", value, err)
+	}
+	if ttl := client.ttls["ratelimit:key"]; ttl != time.Minute.Milliseconds() {
+		t.Fatalf("new counter should expire after ttl: %v", ttl)
+	}
+	// e.g. a counter of a client that failed between INCRBY and PEXPIRE
+	if value, err := store.Incr(context.Background(), "stale", 1, time.Minute); err != nil || value != 6 {
+		t.Fatalf("bad counter: %v %v", value, err)
+	}
+	if _, ok := client.ttls["ratelimit:stale"]; !ok {
+		t.Fatalf("counter without ttl should get one")
+	}
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// SlidingWindow limits calls with a sliding window approximated from the counters of the current and previous
+// fixed windows. Counters are kept in store so the limit can be shared between instances.
+type SlidingWindow struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewSlidingWindow returns sliding window limiter backed by store
+func NewSlidingWindow(store Store) *SlidingWindow {
+	return &SlidingWindow{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Allow counts the call in the current window of key
+func (s *SlidingWindow) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.unlimited() {
+		return Result{Allowed: true}, nil
+	}
+
+	now := s.now()
+	window := now.UnixNano() / int64(limit.Period)
+	elapsed := time.Duration(now.UnixNano() - window*int64(limit.Period))
+	currentKey := key + ":" + strconv.FormatInt(window, 10)
+	previousKey := key + ":" + strconv.FormatInt(window-1, 10)
+
+	previous, err := s.store.Get(ctx, previousKey)
+	if err != nil {
+		return Result{}, err
+	}
+	current, err := s.store.Incr(ctx, currentKey, 1, 2*limit.Period)
+	if err != nil {
+		return Result{}, err
+	}
+
+	weight := 1 - float64(elapsed)/float64(limit.Period)
+	count := float64(previous)*weight + float64(current)
+	requests := float64(limit.Requests)
+	if count <= requests {
+		return Result{Allowed: true, Remaining: int(requests - count)}, nil
+	}
+
+	// rejected call must not count against the window
+	if _, err := s.store.Incr(ctx, currentKey, -1, 2*limit.Period); err != nil {
+		return Result{}, err
+	}
+
+	retryAfter := limit.Period - elapsed
+	if current <= int64(limit.Requests) && previous > 0 {
+		// wait until the previous window weight drops enough for one more call
+		wait := float64(limit.Period)*(1-(requests-float64(current-1)-1)/float64(previous)) - float64(elapsed)
+		if wait > 0 && time.Duration(wait) < retryAfter {
+			retryAfter = time.Duration(wait)
+		}
+	}
+	return Result{RetryAfter: retryAfter}, nil
+}
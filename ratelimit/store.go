@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/budhip/common/internal/sweep"
+)
+
+// Store keeps the counters of sliding window limiter
+type Store interface {
+	// Incr adds n to counter key and returns the new value, a new counter expires after ttl
+	Incr(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+	// Get returns counter key, zero when it does not exist
+	Get(ctx context.Context, key string) (int64, error)
+}
+
+type counter struct {
+	value   int64
+	expires time.Time
+}
+
+// MemoryStore is an in-memory store, counters are only shared within the process
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	sweep    sweep.Schedule
+	now      func() time.Time
+}
+
+// NewMemoryStore returns in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: make(map[string]*counter),
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryStore) Incr(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sweep.Due(now) {
+		m.evict(now)
+	}
+	c, ok := m.counters[key]
+	if !ok || now.After(c.expires) {
+		c = &counter{expires: now.Add(ttl)}
+		m.counters[key] = c
+	}
+	c.value += n
+	return c.value, nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.counters[key]
+	if !ok || m.now().After(c.expires) {
+		return 0, nil
+	}
+	return c.value, nil
+}
+
+// evict drops expired counters, it must be called with lock held
+func (m *MemoryStore) evict(now time.Time) {
+	for k, c := range m.counters {
+		if now.After(c.expires) {
+			delete(m.counters, k)
+		}
+	}
+}
+
+// RedisClient is the subset of Redis commands used by RedisStore. Adapt the client of your choice, e.g. go-redis,
+// by unwrapping its command results. Eval returns integer replies as int64, Get must return empty string when the
+// key does not exist.
+type RedisClient interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+	Get(ctx context.Context, key string) (string, error)
+}
+
+// incrScript increments a counter and sets its ttl in one step, a counter left without ttl gets one on the next call
+const incrScript = `local value = redis.call('INCRBY', KEYS[1], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return value`
+
+// RedisStore keeps counters in Redis so the limit is shared by every instance
+type RedisStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisStore returns store backed by client, every key is prefixed with prefix
+func NewRedisStore(client RedisClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (r *RedisStore) Incr(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	reply, err := r.client.Eval(ctx, incrScript, []string{r.prefix + key}, n, ttl.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+	value, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("ratelimit: unexpected redis reply %T", reply)
+	}
+	return value, nil
+}
+
+func (r *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	value, err := r.client.Get(ctx, r.prefix+key)
+	if err != nil || len(value) == 0 {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/budhip/common/internal/sweep"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+// TokenBucket is an in-memory token bucket limiter, every key has its own bucket refilled at Requests per Period
+type TokenBucket struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweep   sweep.Schedule
+	now     func() time.Time
+}
+
+// NewTokenBucket returns in-memory token bucket limiter
+func NewTokenBucket() *TokenBucket {
+	return &TokenBucket{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key
+func (t *TokenBucket) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.unlimited() {
+		return Result{Allowed: true}, nil
+	}
+
+	capacity := float64(limit.Burst)
+	if capacity <= 0 {
+		capacity = float64(limit.Requests)
+	}
+	rate := float64(limit.Requests) / limit.Period.Seconds()
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sweep.Due(now) {
+		t.evict(now)
+	}
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		t.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	b.period = limit.Period
+
+	if b.tokens < 1 {
+		wait := (1 - b.tokens) / rate
+		return Result{RetryAfter: time.Duration(wait * float64(time.Second))}, nil
+	}
+
+	b.tokens--
+	return Result{Allowed: true, Remaining: int(b.tokens)}, nil
+}
+
+// evict drops buckets that have been refilled completely, it must be called with lock held
+func (t *TokenBucket) evict(now time.Time) {
+	for k, b := range t.buckets {
+		if now.Sub(b.last) > b.period {
+			delete(t.buckets, k)
+		}
+	}
+}
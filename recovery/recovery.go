@@ -0,0 +1,131 @@
+package recovery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	cctx "github.com/budhip/common/context"
+	svcerr "github.com/budhip/common/error"
+	"github.com/budhip/common/metrics"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// IncidentIDKey is the service error attribute and response header holding incident id
+	IncidentIDKey = "incident_id"
+	// RequestIDKey is the metadata key and header holding request id
+	RequestIDKey = "x-request-id"
+
+	cIDKey   = "cid"
+	redacted = "[REDACTED]"
+)
+
+// sensitiveKeys are never copied into incident metadata
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"jwtpayload":    true,
+	"x-api-key":     true,
+}
+
+// Incident describes a recovered panic. Method labels the panics_total metric so it must be bounded, e.g. the
+// gRPC method or the HTTP method, the unbounded HTTP path is only logged.
+type Incident struct {
+	ID        string
+	Time      time.Time
+	Method    string
+	Path      string
+	CID       string
+	RequestID string
+	Metadata  map[string]string
+	Value     interface{}
+	Stack     []byte
+}
+
+// Reporter is called for every recovered panic, e.g. to forward the incident to a crash collector
+type Reporter func(ctx context.Context, incident Incident)
+
+func incidentID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Metadata flattens gRPC metadata or HTTP header into lower-cased keys with sensitive values redacted
+func Metadata(md map[string][]string) map[string]string {
+	data := make(map[string]string, len(md))
+	for k, v := range md {
+		key := strings.ToLower(k)
+		if sensitiveKeys[key] {
+			data[key] = redacted
+			continue
+		}
+		data[key] = strings.Join(v, ",")
+	}
+	return data
+}
+
+// NewIncident returns incident of panic p, it must be called from the recovering goroutine to capture the stack
+func NewIncident(ctx context.Context, method string, p interface{}, metadata map[string]string) Incident {
+	incident := Incident{
+		ID:        incidentID(),
+		Time:      time.Now(),
+		Method:    method,
+		CID:       cctx.GetContextAsString(ctx, cctx.CtxCID),
+		RequestID: cctx.GetContextAsString(ctx, cctx.CtxRequestID),
+		Metadata:  metadata,
+		Value:     p,
+		Stack:     debug.Stack(),
+	}
+
+	if len(incident.CID) == 0 {
+		incident.CID = metadata[cIDKey]
+	}
+	if len(incident.RequestID) == 0 {
+		incident.RequestID = metadata[RequestIDKey]
+	}
+
+	return incident
+}
+
+// Report logs the incident, counts it and passes it to every reporter
+func Report(ctx context.Context, incident Incident, reporters ...Reporter) {
+	log.Printf("panic recovered: incident_id=%s method=%s path=%s cID=%s request_id=%s panic=%v metadata=%v\n%s",
+		incident.ID, incident.Method, incident.Path, incident.CID, incident.RequestID, incident.Value,
+		incident.Metadata, incident.Stack)
+
+	metrics.NewCounter("panics_total", "method", incident.Method).Add(1)
+
+	for _, reporter := range reporters {
+		report(ctx, reporter, incident)
+	}
+}
+
+// report calls reporter, a panicking reporter must not crash the recovery itself
+func report(ctx context.Context, reporter Reporter, incident Incident) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("panic reporter failed: incident_id=%s panic=%v", incident.ID, p)
+		}
+	}()
+
+	reporter(ctx, incident)
+}
+
+// ServiceError returns the error to send to client, it only exposes the incident id
+func (i Incident) ServiceError() svcerr.ServiceError {
+	return svcerr.ServiceError{
+		Status:     codes.Internal,
+		Code:       "INTERNAL",
+		Message:    "internal server error, incident id " + i.ID,
+		Attributes: map[string]string{IncidentIDKey: i.ID},
+	}
+}
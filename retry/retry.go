@@ -0,0 +1,151 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff computes exponential backoff with jitter
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Jitter is the random fraction of the delay, 0 disables jitter and 1 is full jitter
+	Jitter float64
+}
+
+// DefaultBackoff starts at 100ms and doubles up to 5s with 20% jitter
+var DefaultBackoff = Backoff{
+	Initial:    100 * time.Millisecond,
+	Max:        5 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+var (
+	randMu sync.Mutex
+	rnd    = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func random() float64 {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return rnd.Float64()
+}
+
+// Duration returns the delay before retry attempt, the first retry is attempt 1
+func (b Backoff) Duration(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(b.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		jitter := math.Min(b.Jitter, 1)
+		delay = delay*(1-jitter) + delay*jitter*random()
+	}
+	return time.Duration(delay)
+}
+
+// Budget is a token bucket that stops retries when most calls fail, to avoid retry storms.
+// Every failure takes a token and every success returns TokenRatio token, retry is allowed
+// while more than half of the tokens are left. It is safe for concurrent use.
+type Budget struct {
+	mu         sync.Mutex
+	tokens     float64
+	maxTokens  float64
+	tokenRatio float64
+}
+
+// NewBudget returns full budget, e.g. NewBudget(10, 0.1) allows retries while less than about 1 in 10 calls fails
+func NewBudget(maxTokens, tokenRatio float64) *Budget {
+	return &Budget{
+		tokens:     maxTokens,
+		maxTokens:  maxTokens,
+		tokenRatio: tokenRatio,
+	}
+}
+
+// Allow reports whether a retry is allowed
+func (b *Budget) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.maxTokens/2
+}
+
+// Success records a successful call
+func (b *Budget) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.maxTokens, b.tokens+b.tokenRatio)
+}
+
+// Failure records a failed call
+func (b *Budget) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Max(0, b.tokens-1)
+}
+
+// Policy configures retries
+type Policy struct {
+	// MaxAttempts includes the first attempt, values below 2 disable retry
+	MaxAttempts int
+	Backoff     Backoff
+	// Budget is shared by every call of the client, nil means unlimited
+	Budget *Budget
+}
+
+// Delay returns the delay before retry attempt, at least the server hint retryAfter
+func (p Policy) Delay(attempt int, retryAfter time.Duration) time.Duration {
+	delay := p.Backoff.Duration(attempt)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// Allow records the failure of attempt and reports whether it may be retried
+func (p Policy) Allow(attempt int) bool {
+	if p.Budget != nil {
+		p.Budget.Failure()
+	}
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	return p.Budget == nil || p.Budget.Allow()
+}
+
+// Success records a successful attempt
+func (p Policy) Success() {
+	if p.Budget != nil {
+		p.Budget.Success()
+	}
+}
+
+// Sleep waits for d, it returns early with the context error when ctx is done or its deadline is before d
+func Sleep(ctx context.Context, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return context.DeadlineExceeded
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
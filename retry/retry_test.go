@@ -0,0 +1,47 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	backoff := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2, Jitter: 0.5}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 1, max: 100 * time.Millisecond},
+		{attempt: 2, max: 200 * time.Millisecond},
+		{attempt: 3, max: 400 * time.Millisecond},
+		{attempt: 10, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		got := backoff.Duration(tt.attempt)
+		if got > tt.max || got < tt.max/2 {
+			t.Fatalf("bad backoff for attempt %d: %v", tt.attempt, got)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, Budget: NewBudget(4, 1)}
+
+	if !policy.Allow(1) {
+		t.Fatalf("retry should be allowed")
+	}
+	if policy.Allow(3) {
+		t.Fatalf("retry over max attempts should not be allowed")
+	}
+	if policy.Allow(1) {
+		t.Fatalf("retry over budget should not be allowed")
+	}
+
+	policy.Success()
+	policy.Success()
+	if !policy.Budget.Allow() {
+		t.Fatalf("budget should be refilled")
+	}
+}
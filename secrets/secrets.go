@@ -0,0 +1,171 @@
+// Package secrets loads credentials such as database passwords, TLS material and service account keys
+// from the environment, files, mounted Kubernetes secrets or Vault.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a secret does not exist
+var ErrNotFound = errors.New("secrets: not found")
+
+// Provider returns the current value of secrets by name, values may change when secrets are rotated
+type Provider interface {
+	Get(ctx context.Context, name string) ([]byte, error)
+}
+
+// String returns secret name of p as string
+func String(ctx context.Context, p Provider, name string) (string, error) {
+	value, err := p.Get(ctx, name)
+	return string(value), err
+}
+
+// Env reads secrets from environment variables, name db-password with prefix APP_ reads APP_DB_PASSWORD
+type Env struct {
+	Prefix string
+}
+
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Get returns environment variable of name, see Env
+func (e Env) Get(_ context.Context, name string) ([]byte, error) {
+	value, ok := os.LookupEnv(e.Prefix + envName(name))
+	if !ok {
+		return nil, fmt.Errorf("%w: env %s", ErrNotFound, e.Prefix+envName(name))
+	}
+	return []byte(value), nil
+}
+
+// File reads secrets from a JSON object of names and string values, e.g. a local secrets.json.
+// The file is read on every Get so changes are picked up.
+type File struct {
+	Path string
+}
+
+// Get returns value name of the JSON file, values must be strings
+func (f File) Get(_ context.Context, name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("secrets: parse %s: %v", f.Path, err)
+	}
+	value, ok := values[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s in %s", ErrNotFound, name, f.Path)
+	}
+	return []byte(value), nil
+}
+
+// Kubernetes reads secrets from a mounted secret volume where every key is a file of Dir.
+// The kubelet swaps the files atomically on rotation and they are read on every Get.
+type Kubernetes struct {
+	Dir string
+}
+
+// Get returns the content of file name of the mounted secret
+func (k Kubernetes) Get(_ context.Context, name string) ([]byte, error) {
+	if len(name) == 0 || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("secrets: invalid secret key %q", name)
+	}
+
+	value, err := ioutil.ReadFile(filepath.Join(k.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s in %s", ErrNotFound, name, k.Dir)
+	}
+	return value, err
+}
+
+type cached struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// Cache caches secrets of a provider for ttl, e.g. to avoid calling Vault for every new database connection
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	values map[string]cached
+}
+
+// NewCache returns provider caching secrets of provider for ttl
+func NewCache(provider Provider, ttl time.Duration) *Cache {
+	return &Cache{provider: provider, ttl: ttl, now: time.Now, values: map[string]cached{}}
+}
+
+// Get returns the cached secret name, looking it up when it is missing or expired
+func (c *Cache) Get(ctx context.Context, name string) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.values[name]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expiresAt) {
+		return entry.value, nil
+	}
+
+	value, err := c.provider.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.values[name] = cached{value: value, expiresAt: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// Watch checks secret name of p every interval and calls fn with its value when it changed, until ctx is done.
+// fn is not called for the value at the start, lookup failures are logged and keep the previous value.
+func Watch(ctx context.Context, p Provider, name string, interval time.Duration, fn func(value []byte)) {
+	previous, err := p.Get(ctx, name)
+	if err != nil {
+		log.Printf("secrets: watch %s: %v", name, err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		value, err := p.Get(ctx, name)
+		if err != nil {
+			log.Printf("secrets: watch %s: %v", name, err)
+			continue
+		}
+		if previous != nil && !bytes.Equal(value, previous) {
+			fn(value)
+		}
+		previous = value
+	}
+}
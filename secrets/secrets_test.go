@@ -0,0 +1,168 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnv(t *testing.T) {
+	os.Setenv("APP_DB_PASSWORD", "secret")
+	defer os.Unsetenv("APP_DB_PASSWORD")
+
+	ctx := context.Background()
+	if value, err := String(ctx, Env{Prefix: "APP_"}, "db-password"); err != nil || value != "secret" {
+		t.Fatalf("want secret, got %q %v", value, err)
+	}
+	if _, err := (Env{Prefix: "APP_"}).Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.json")
+	if err := ioutil.WriteFile(path, []byte(`{"db-password":"secret"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if value, err := String(ctx, File{Path: path}, "db-password"); err != nil || value != "secret" {
+		t.Fatalf("want secret, got %q %v", value, err)
+	}
+	if _, err := (File{Path: path}).Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestKubernetes(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "password"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	k := Kubernetes{Dir: dir}
+	if value, err := String(ctx, k, "password"); err != nil || value != "secret" {
+		t.Fatalf("want secret, got %q %v", value, err)
+	}
+	if _, err := k.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	for _, name := range []string{"../password", "..data", ""} {
+		if _, err := k.Get(ctx, name); err == nil || errors.Is(err, ErrNotFound) {
+			t.Fatalf("%q should be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestVault(t *testing.T) {
+	fake := NewFakeVault("token")
+	fake.Put("database/orders", map[string]interface{}{"password": "secret", "port": 5432})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	vault := NewVault(server.URL, "token", "", server.Client())
+	if value, err := String(ctx, vault, "database/orders#password"); err != nil || value != "secret" {
+		t.Fatalf("want secret, got %q %v", value, err)
+	}
+	for _, name := range []string{"database/orders#user", "database/users#password"} {
+		if _, err := vault.Get(ctx, name); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: want ErrNotFound, got %v", name, err)
+		}
+	}
+	if _, err := vault.Get(ctx, "database/orders"); err == nil {
+		t.Fatalf("name without key should fail")
+	}
+	if value, err := String(ctx, vault, "database/orders#port"); err != nil || value != "5432" {
+		t.Fatalf("non-string value should be returned as JSON, got %q %v", value, err)
+	}
+
+	denied := NewVault(server.URL, "wrong", "", server.Client())
+	if _, err := denied.Get(ctx, "database/orders#password"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("wrong token should be denied, got %v", err)
+	}
+}
+
+type countingProvider struct {
+	calls int
+	value string
+}
+
+func (p *countingProvider) Get(context.Context, string) ([]byte, error) {
+	p.calls++
+	return []byte(p.value), nil
+}
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	provider := &countingProvider{value: "old"}
+	cache := NewCache(provider, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if value, _ := String(ctx, cache, "password"); value != "old" {
+			t.Fatalf("want old, got %s", value)
+		}
+	}
+	if provider.calls != 1 {
+		t.Fatalf("want 1 lookup, got %d", provider.calls)
+	}
+
+	provider.value = "new"
+	now = now.Add(2 * time.Minute)
+	if value, _ := String(ctx, cache, "password"); value != "new" {
+		t.Fatalf("expired secret should be looked up again, got %s", value)
+	}
+}
+
+// signallingProvider closes read after the first Get
+type signallingProvider struct {
+	Provider
+	read chan struct{}
+	once sync.Once
+}
+
+func (p *signallingProvider) Get(ctx context.Context, name string) ([]byte, error) {
+	value, err := p.Provider.Get(ctx, name)
+	p.once.Do(func() { close(p.read) })
+	return value, err
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string, 1)
+	provider := &signallingProvider{Provider: Kubernetes{Dir: dir}, read: make(chan struct{})}
+	go Watch(ctx, provider, "password", 10*time.Millisecond, func(value []byte) {
+		changes <- string(value)
+	})
+
+	<-provider.read
+	if err := ioutil.WriteFile(path, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case value := <-changes:
+		if value != "new" {
+			t.Fatalf("want new, got %s", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("rotation not noticed")
+	}
+}
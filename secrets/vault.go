@@ -0,0 +1,172 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Vault reads secrets of a KV version 2 secrets engine of Vault, or of anything serving its HTTP API
+// like FakeVault. Names are "<path>#<key>", e.g. "database/orders#password" reads key password of secret
+// database/orders.
+type Vault struct {
+	addr   string
+	token  string
+	mount  string
+	client *http.Client
+}
+
+// NewVault returns Vault client of addr, e.g. https://vault:8200, authenticating with token.
+// mount defaults to secret and client to http.DefaultClient.
+func NewVault(addr, token, mount string, client *http.Client) *Vault {
+	if len(mount) == 0 {
+		mount = "secret"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Vault{addr: strings.TrimSuffix(addr, "/"), token: token, mount: strings.Trim(mount, "/"), client: client}
+}
+
+// vaultResponse is the response of reading a KV version 2 secret
+type vaultResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+func splitName(name string) (string, string, error) {
+	i := strings.LastIndex(name, "#")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("secrets: vault secret name %q is not <path>#<key>", name)
+	}
+	return strings.Trim(name[:i], "/"), name[i+1:], nil
+}
+
+// Get returns key of the latest version of the secret at path of name "<path>#<key>", values that are not
+// strings are returned as JSON
+func (v *Vault) Get(ctx context.Context, name string) ([]byte, error) {
+	path, key, err := splitName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/%s/data/%s", v.addr, v.mount, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: vault %s", ErrNotFound, path)
+	}
+
+	var secret vaultResponse
+	if err := json.Unmarshal(body, &secret); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("secrets: vault %s: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secrets: vault %s: status %d %s", path, resp.StatusCode, strings.Join(secret.Errors, ", "))
+	}
+
+	value, ok := secret.Data.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: vault %s#%s", ErrNotFound, path, key)
+	}
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	// numbers, booleans and objects such as a service account key are returned as JSON
+	return json.Marshal(value)
+}
+
+// FakeVault serves the KV version 2 read and write API of Vault from memory, for tests and local development
+// without a Vault server, e.g. http.ListenAndServe(":8200", secrets.NewFakeVault("dev-token")).
+type FakeVault struct {
+	token string
+
+	mu      sync.RWMutex
+	secrets map[string]map[string]interface{}
+}
+
+// NewFakeVault returns fake vault accepting token, any token when empty
+func NewFakeVault(token string) *FakeVault {
+	return &FakeVault{token: token, secrets: map[string]map[string]interface{}{}}
+}
+
+// Put writes data to secret path, replacing its previous version
+func (f *FakeVault) Put(path string, data map[string]interface{}) {
+	values := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		values[k] = v
+	}
+
+	f.mu.Lock()
+	f.secrets[strings.Trim(path, "/")] = values
+	f.mu.Unlock()
+}
+
+func writeVaultError(w http.ResponseWriter, status int, errs ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string][]string{"errors": errs})
+}
+
+// ServeHTTP reads secrets with GET and writes them with POST or PUT of /v1/<mount>/data/<path>
+func (f *FakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(f.token) > 0 && r.Header.Get("X-Vault-Token") != f.token {
+		writeVaultError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	// /v1/<mount>/data/<path>, the fake serves every mount
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/"), "/data/", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		writeVaultError(w, http.StatusNotFound)
+		return
+	}
+	path := strings.Trim(parts[1], "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		f.mu.RLock()
+		values, ok := f.secrets[path]
+		f.mu.RUnlock()
+		if !ok {
+			writeVaultError(w, http.StatusNotFound)
+			return
+		}
+
+		var resp vaultResponse
+		resp.Data.Data = values
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	case http.MethodPost, http.MethodPut:
+		var req struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeVaultError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		f.Put(path, req.Data)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeVaultError(w, http.StatusMethodNotAllowed)
+	}
+}
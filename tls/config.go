@@ -0,0 +1,217 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Option configures TLS config built by NewConfig
+type Option func(*builder)
+
+type builder struct {
+	cfg      *tls.Config
+	warnings []string
+	err      error
+}
+
+func (b *builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// NewConfig returns TLS config built from opts, the minimum version defaults to TLS 1.2.
+// It fails on invalid certificate material and on inconsistent options, e.g. verifying
+// client certificates without client CA.
+func NewConfig(opts ...Option) (*tls.Config, error) {
+	b := &builder{
+		cfg: &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	cfg := b.cfg
+	if cfg.MaxVersion != 0 && cfg.MaxVersion < cfg.MinVersion {
+		return nil, fmt.Errorf("tls: max version %s is lower than min version %s",
+			versionName(cfg.MaxVersion), versionName(cfg.MinVersion))
+	}
+	if cfg.ClientAuth >= tls.VerifyClientCertIfGiven && cfg.ClientCAs == nil {
+		return nil, errors.New("tls: client CA is required to verify client certificates")
+	}
+	logWarnings(b.warnings)
+
+	return cfg, nil
+}
+
+// WithMinVersion sets the minimum TLS version, e.g. tls.VersionTLS13
+func WithMinVersion(version uint16) Option {
+	return func(b *builder) {
+		b.cfg.MinVersion = version
+	}
+}
+
+// WithMaxVersion sets the maximum TLS version
+func WithMaxVersion(version uint16) Option {
+	return func(b *builder) {
+		b.cfg.MaxVersion = version
+	}
+}
+
+// WithCipherSuites sets the TLS 1.0-1.2 cipher suites, insecure suites are rejected.
+// TLS 1.3 suites are not configurable.
+func WithCipherSuites(suites ...uint16) Option {
+	return func(b *builder) {
+		for _, id := range suites {
+			for _, insecure := range tls.InsecureCipherSuites() {
+				if id == insecure.ID {
+					b.fail(fmt.Errorf("tls: insecure cipher suite %s", insecure.Name))
+					return
+				}
+			}
+		}
+		b.cfg.CipherSuites = suites
+	}
+}
+
+// WithCurves sets the elliptic curves preference for ECDHE handshakes
+func WithCurves(curves ...tls.CurveID) Option {
+	return func(b *builder) {
+		b.cfg.CurvePreferences = curves
+	}
+}
+
+// WithALPN sets the supported application protocols in preference order, e.g. "h2", "http/1.1"
+func WithALPN(protocols ...string) Option {
+	return func(b *builder) {
+		b.cfg.NextProtos = protocols
+	}
+}
+
+// WithServerName sets the server name clients verify and send in SNI
+func WithServerName(serverName string) Option {
+	return func(b *builder) {
+		b.cfg.ServerName = serverName
+	}
+}
+
+// WithKeyPair adds key pair presented to the peer, it fails on invalid PEM, mismatching key or expired certificate
+func WithKeyPair(cert, key []byte) Option {
+	return func(b *builder) {
+		keyPair, warnings, err := ParseKeyPair(cert, key)
+		if err != nil {
+			b.fail(err)
+			return
+		}
+		b.warnings = append(b.warnings, warnings...)
+		b.cfg.Certificates = append(b.cfg.Certificates, keyPair)
+	}
+}
+
+// WithSource serves the current certificate of source, see Source for the hot-reloaded CA pool
+func WithSource(source *Source) Option {
+	return func(b *builder) {
+		b.cfg.GetCertificate = source.GetCertificate
+		b.cfg.GetClientCertificate = source.GetClientCertificate
+	}
+}
+
+// WithRootCAs sets the CA pool clients verify servers against
+func WithRootCAs(ca []byte) Option {
+	return func(b *builder) {
+		b.cfg.RootCAs = b.pool(ca)
+	}
+}
+
+// WithClientCAs sets the CA pool servers verify client certificates against
+func WithClientCAs(ca []byte) Option {
+	return func(b *builder) {
+		b.cfg.ClientCAs = b.pool(ca)
+	}
+}
+
+func (b *builder) pool(ca []byte) *x509.CertPool {
+	pool, warnings, err := ParseCA(ca)
+	if err != nil {
+		b.fail(err)
+		return nil
+	}
+	b.warnings = append(b.warnings, warnings...)
+	return pool
+}
+
+// WithClientAuth sets how servers ask for client certificates, use tls.RequestClientCert,
+// tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert. Verifying modes need WithClientCAs.
+func WithClientAuth(clientAuth tls.ClientAuthType) Option {
+	return func(b *builder) {
+		b.cfg.ClientAuth = clientAuth
+	}
+}
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func versionName(version uint16) string {
+	for name, v := range versions {
+		if v == version {
+			return "TLS " + name
+		}
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// ParseVersion parses TLS version such as "1.2" or "TLS1.3"
+func ParseVersion(s string) (uint16, error) {
+	name := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "TLS")
+	if version, ok := versions[strings.TrimSpace(name)]; ok {
+		return version, nil
+	}
+	return 0, fmt.Errorf("tls: unknown version %q", s)
+}
+
+// ParseCipherSuites parses secure cipher suite names such as "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"
+func ParseCipherSuites(names ...string) ([]uint16, error) {
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := cipherSuite(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("tls: unknown or insecure cipher suite %q", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+var clientAuths = map[string]tls.ClientAuthType{
+	"none":            tls.NoClientCert,
+	"request":         tls.RequestClientCert,
+	"verify-if-given": tls.VerifyClientCertIfGiven,
+	"require":         tls.RequireAndVerifyClientCert,
+}
+
+// ParseClientAuth parses client auth mode "none", "request", "verify-if-given" or "require"
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	if clientAuth, ok := clientAuths[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return clientAuth, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("tls: unknown client auth %q", s)
+}
@@ -0,0 +1,141 @@
+package tls
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	"github.com/budhip/common/tls/tlstest"
+)
+
+func TestNewConfig(t *testing.T) {
+	// the client skips the static check, the fixture certificate has no SAN to verify a server name against
+	client := &tls.Config{InsecureSkipVerify: true}
+
+	server, err := NewConfig(
+		WithKeyPair(cert(), key()),
+		WithClientCAs(ca()),
+		WithClientAuth(tls.VerifyClientCertIfGiven),
+		WithMinVersion(tls.VersionTLS13),
+	)
+	if err != nil {
+		t.Fatalf("bad config: %v", err)
+	}
+	if err := handshake(server, client); err != nil {
+		t.Fatalf("client certificate is optional: %v", err)
+	}
+
+	server.ClientAuth = tls.RequireAndVerifyClientCert
+	if err := handshake(server, client); err == nil {
+		t.Fatalf("client certificate is required")
+	}
+
+	client, err = NewConfig(WithKeyPair(cert(), key()), WithRootCAs(ca()))
+	if err != nil {
+		t.Fatalf("bad config: %v", err)
+	}
+	client.InsecureSkipVerify = true
+	if err := handshake(server, client); err != nil {
+		t.Fatalf("bad handshake: %v", err)
+	}
+}
+
+func TestNewConfigInvalid(t *testing.T) {
+	tests := [][]Option{
+		{WithClientAuth(tls.RequireAndVerifyClientCert)},
+		{WithMinVersion(tls.VersionTLS13), WithMaxVersion(tls.VersionTLS12)},
+		{WithCipherSuites(tls.TLS_RSA_WITH_RC4_128_SHA)},
+		{WithRootCAs([]byte("invalid"))},
+		{WithKeyPair(cert(), nil)},
+	}
+
+	for i, opts := range tests {
+		if _, err := NewConfig(opts...); err == nil {
+			t.Fatalf("options %d should fail", i)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if v, err := ParseVersion("TLS1.3"); err != nil || v != tls.VersionTLS13 {
+		t.Fatalf("bad version: %v %v", v, err)
+	}
+	if _, err := ParseCipherSuites("TLS_RSA_WITH_RC4_128_SHA"); err == nil {
+		t.Fatalf("insecure cipher suite should fail")
+	}
+	if suites, err := ParseCipherSuites("TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"); err != nil || len(suites) != 1 {
+		t.Fatalf("bad cipher suites: %v %v", suites, err)
+	}
+	if auth, err := ParseClientAuth("verify-if-given"); err != nil || auth != tls.VerifyClientCertIfGiven {
+		t.Fatalf("bad client auth: %v %v", auth, err)
+	}
+}
+
+func TestNewConfigGenerated(t *testing.T) {
+	for _, algorithm := range []tlstest.KeyAlgorithm{tlstest.ECDSA, tlstest.RSA, tlstest.Ed25519} {
+		ca, err := tlstest.NewCA(tlstest.WithKeyAlgorithm(algorithm))
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverCert, _ := ca.Server(tlstest.WithKeyAlgorithm(algorithm))
+		clientCert, _ := ca.Client(tlstest.WithKeyAlgorithm(algorithm))
+
+		server, err := NewConfig(
+			WithKeyPair(serverCert.CertPEM, serverCert.KeyPEM),
+			WithClientCAs(ca.CertPEM),
+			WithClientAuth(tls.RequireAndVerifyClientCert),
+		)
+		if err != nil {
+			t.Fatalf("bad %v server config: %v", algorithm, err)
+		}
+		client, err := NewConfig(
+			WithKeyPair(clientCert.CertPEM, clientCert.KeyPEM),
+			WithRootCAs(ca.CertPEM),
+			WithServerName("localhost"),
+		)
+		if err != nil {
+			t.Fatalf("bad %v client config: %v", algorithm, err)
+		}
+
+		if err := handshake(server, client); err != nil {
+			t.Fatalf("bad %v handshake: %v", algorithm, err)
+		}
+	}
+}
+
+func TestSettings(t *testing.T) {
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, _ := ca.Server()
+	clientCert, _ := ca.Client()
+
+	serverSettings := Settings{CA: ca.CertPEM, Cert: serverCert.CertPEM, Key: serverCert.KeyPEM, MinVersion: "1.3", ClientAuth: "require"}
+	clientSettings := Settings{CA: ca.CertPEM, Cert: clientCert.CertPEM, Key: clientCert.KeyPEM, ServerName: "localhost"}
+	if err := serverSettings.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := serverSettings.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := clientSettings.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.MinVersion != tls.VersionTLS13 || server.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Fatalf("settings should apply, got min version %x and client auth %v", server.MinVersion, server.ClientAuth)
+	}
+	if err := handshake(server, client); err != nil {
+		t.Fatalf("bad handshake: %v", err)
+	}
+
+	if err := (Settings{ClientAuth: "always"}).Validate(); err == nil {
+		t.Fatalf("unknown client auth should fail")
+	}
+	if strings.Contains(serverSettings.String(), "PRIVATE KEY") {
+		t.Fatalf("key should be redacted")
+	}
+}
@@ -0,0 +1,109 @@
+package tls
+
+import (
+	"crypto/tls"
+
+	"github.com/budhip/common/config"
+)
+
+// Settings are the TLS settings of a service, its tags load it with the config package.
+// CA, Cert and Key are PEM, versions are like "1.2" and ClientAuth is one of ParseClientAuth.
+type Settings struct {
+	CA           []byte
+	Cert         []byte
+	Key          []byte `secret:"true"`
+	MinVersion   string
+	MaxVersion   string
+	CipherSuites []string
+	ClientAuth   string
+	ServerName   string
+}
+
+// String returns settings with the key redacted
+func (s Settings) String() string {
+	return config.String(s)
+}
+
+// Validate checks certificate material and the names of versions, cipher suites and client auth
+func (s Settings) Validate() error {
+	if _, err := s.options(); err != nil {
+		return err
+	}
+	if s.CA != nil {
+		if _, _, err := ParseCA(s.CA); err != nil {
+			return err
+		}
+	}
+	if s.Cert != nil || s.Key != nil {
+		if _, _, err := ParseKeyPair(s.Cert, s.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// options returns the options shared by servers and clients
+func (s Settings) options() ([]Option, error) {
+	var opts []Option
+	if len(s.MinVersion) > 0 {
+		version, err := ParseVersion(s.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithMinVersion(version))
+	}
+	if len(s.MaxVersion) > 0 {
+		version, err := ParseVersion(s.MaxVersion)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithMaxVersion(version))
+	}
+	if len(s.CipherSuites) > 0 {
+		suites, err := ParseCipherSuites(s.CipherSuites...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithCipherSuites(suites...))
+	}
+	if len(s.ClientAuth) > 0 {
+		if _, err := ParseClientAuth(s.ClientAuth); err != nil {
+			return nil, err
+		}
+	}
+	if s.Cert != nil || s.Key != nil {
+		opts = append(opts, WithKeyPair(s.Cert, s.Key))
+	}
+	return opts, nil
+}
+
+// ServerConfig returns server TLS config of s, CA verifies client certificates of ClientAuth
+func (s Settings) ServerConfig(opts ...Option) (*tls.Config, error) {
+	base, err := s.options()
+	if err != nil {
+		return nil, err
+	}
+	if s.CA != nil {
+		base = append(base, WithClientCAs(s.CA))
+	}
+	if len(s.ClientAuth) > 0 {
+		clientAuth, _ := ParseClientAuth(s.ClientAuth)
+		base = append(base, WithClientAuth(clientAuth))
+	}
+	return NewConfig(append(base, opts...)...)
+}
+
+// ClientConfig returns client TLS config of s, CA verifies the server certificate of ServerName
+func (s Settings) ClientConfig(opts ...Option) (*tls.Config, error) {
+	base, err := s.options()
+	if err != nil {
+		return nil, err
+	}
+	if s.CA != nil {
+		base = append(base, WithRootCAs(s.CA))
+	}
+	if len(s.ServerName) > 0 {
+		base = append(base, WithServerName(s.ServerName))
+	}
+	return NewConfig(append(base, opts...)...)
+}
@@ -0,0 +1,257 @@
+package tls
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/budhip/common/secrets"
+)
+
+// Event is reported on every certificate reload, Err is set when the new files are invalid
+// and the previous certificate is still served. Warnings flag certificates close to expiry.
+type Event struct {
+	Time     time.Time
+	NotAfter time.Time
+	Warnings []string
+	Err      error
+}
+
+// Source serves certificate and CA pool loaded from files or a secrets provider and reloads them when they change,
+// e.g. when cert-manager rotates a mounted secret. It is safe for concurrent use.
+type Source struct {
+	// certName and caName are the files or secrets read, for errors
+	certName string
+	caName   string
+	read     func() (cert, key, ca []byte, err error)
+	onReload func(Event)
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+	sum  [sha256.Size]byte
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewSource loads certificate and optional CA from files and checks them for changes every interval.
+// onReload may be nil. Close stops watching the files.
+func NewSource(certFile, keyFile, caFile string, interval time.Duration, onReload func(Event)) (*Source, error) {
+	read := func() (cert, key, ca []byte, err error) {
+		if cert, err = ioutil.ReadFile(certFile); err != nil {
+			return nil, nil, nil, err
+		}
+		if key, err = ioutil.ReadFile(keyFile); err != nil {
+			return nil, nil, nil, err
+		}
+		if len(caFile) > 0 {
+			if ca, err = ioutil.ReadFile(caFile); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		return cert, key, ca, nil
+	}
+	return newSource(certFile, caFile, read, interval, onReload)
+}
+
+// NewSecretSource loads certificate, key and optional CA from secrets of provider and checks them for changes every
+// interval, e.g. PEM values of Vault. caName may be empty, onReload may be nil. Close stops watching the secrets.
+func NewSecretSource(provider secrets.Provider, certName, keyName, caName string, interval time.Duration,
+	onReload func(Event)) (*Source, error) {
+	read := func() (cert, key, ca []byte, err error) {
+		ctx := context.Background()
+		if cert, err = provider.Get(ctx, certName); err != nil {
+			return nil, nil, nil, err
+		}
+		if key, err = provider.Get(ctx, keyName); err != nil {
+			return nil, nil, nil, err
+		}
+		if len(caName) > 0 {
+			if ca, err = provider.Get(ctx, caName); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		return cert, key, ca, nil
+	}
+	return newSource(certName, caName, read, interval, onReload)
+}
+
+func newSource(certName, caName string, read func() (cert, key, ca []byte, err error), interval time.Duration,
+	onReload func(Event)) (*Source, error) {
+	s := &Source{
+		certName: certName,
+		caName:   caName,
+		read:     read,
+		onReload: onReload,
+		stop:     make(chan struct{}),
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		go s.watch(interval)
+	}
+
+	return s, nil
+}
+
+func (s *Source) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			_ = s.Reload()
+		}
+	}
+}
+
+// Close stops watching the files
+func (s *Source) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+}
+
+// Reload loads the files or secrets if they changed since the last load, the previous certificate is kept on error
+func (s *Source) Reload() error {
+	certPEM, keyPEM, caPEM, err := s.read()
+	if err != nil {
+		return s.report(Event{Err: err})
+	}
+
+	sum := sha256.Sum256(bytes.Join([][]byte{certPEM, keyPEM, caPEM}, []byte{0}))
+	s.mu.RLock()
+	unchanged := s.cert != nil && sum == s.sum
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	pool, keyPair, warnings, err := load(caPEM, certPEM, keyPEM, false)
+	if err != nil {
+		return s.report(Event{Err: err})
+	}
+	if keyPair == nil {
+		return s.report(Event{Err: fmt.Errorf("tls: no certificate found in %s", s.certName)})
+	}
+	if len(s.caName) > 0 && pool == nil {
+		return s.report(Event{Err: fmt.Errorf("tls: no CA certificate found in %s", s.caName)})
+	}
+
+	s.mu.Lock()
+	s.cert = keyPair
+	s.pool = pool
+	s.sum = sum
+	s.mu.Unlock()
+
+	return s.report(Event{NotAfter: keyPair.Leaf.NotAfter, Warnings: warnings})
+}
+
+func (s *Source) report(event Event) error {
+	event.Time = time.Now()
+	if s.onReload != nil {
+		s.onReload(event)
+	}
+	return event.Err
+}
+
+func (s *Source) current() (*tls.Certificate, *x509.CertPool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cert, s.pool
+}
+
+// GetCertificate returns the current certificate, for tls.Config.GetCertificate
+func (s *Source) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, _ := s.current()
+	return cert, nil
+}
+
+// GetClientCertificate returns the current certificate, for tls.Config.GetClientCertificate
+func (s *Source) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, _ := s.current()
+	return cert, nil
+}
+
+// verify verifies certs against the current CA pool for usage, and for serverName unless it is empty
+func (s *Source) verify(certs []*x509.Certificate, serverName string, usage x509.ExtKeyUsage) error {
+	if len(certs) == 0 {
+		return errors.New("tls: no peer certificate")
+	}
+
+	_, pool := s.current()
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// VerifyConnection verifies the server certificate against the current CA pool and the server name of the
+// connection, for tls.Config.VerifyConnection of clients. The config must set InsecureSkipVerify to skip the
+// static check. Connections without server name are rejected, the name is the one dialed unless the config sets it.
+func (s *Source) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.ServerName) == 0 {
+		return errors.New("tls: server name is required to verify the server certificate")
+	}
+	return s.verify(cs.PeerCertificates, cs.ServerName, x509.ExtKeyUsageServerAuth)
+}
+
+// ServerConfig returns server TLS config that always serves the current certificate.
+// If mutual is true, client certificates are required and verified against the current CA pool, which needs the
+// CA file. Handshakes then run with a copy of the returned config, set fields such as NextProtos before serving.
+func (s *Source) ServerConfig(mutual bool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.GetCertificate,
+	}
+	if mutual {
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			_, pool := s.current()
+			if pool == nil {
+				return nil, errors.New("tls: mutual TLS requires a CA file to verify client certificates")
+			}
+			// the pool changes on reload, ClientCAs of the config of the connection keeps it current
+			connCfg := cfg.Clone()
+			connCfg.GetConfigForClient = nil
+			connCfg.ClientCAs = pool
+			connCfg.ClientAuth = tls.RequireAndVerifyClientCert
+			return connCfg, nil
+		}
+	}
+	return cfg
+}
+
+// ClientConfig returns client TLS config that always presents the current certificate and verifies the server
+// against the current CA pool. serverName may be empty when the dialer sets it, e.g. gRPC from the dial target.
+func (s *Source) ClientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		ServerName:           serverName,
+		GetClientCertificate: s.GetClientCertificate,
+		// the server is verified by VerifyConnection with the current CA pool
+		InsecureSkipVerify: true,
+		VerifyConnection:   s.VerifyConnection,
+	}
+}
@@ -0,0 +1,280 @@
+package tls
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/budhip/common/secrets"
+	"github.com/budhip/common/tls/tlstest"
+)
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func handshake(server, client *tls.Config) error {
+	_, err := handshakeState(server, client)
+	return err
+}
+
+// handshakeState returns the connection state of the client after the handshake
+func handshakeState(server, client *tls.Config) (tls.ConnectionState, error) {
+	// loopback TCP is buffered, unlike net.Pipe both sides may write at once, e.g. a server alert
+	// while the client still sends its TLS 1.3 Finished message
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer listener.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		errs <- tls.Server(conn, server).Handshake()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+
+	clientConn := tls.Client(conn, client)
+	if err := clientConn.Handshake(); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return clientConn.ConnectionState(), <-errs
+}
+
+// newSources returns server and client sources of certificates issued by ca, writing them to dir
+func newSources(t *testing.T, dir string, ca *tlstest.CA, onReload func(Event)) (server, client *Source) {
+	t.Helper()
+
+	serverCert, err := ca.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := ca.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := writeFile(t, dir, "ca.crt", ca.CertPEM)
+
+	server, err = NewSource(writeFile(t, dir, "server.crt", serverCert.CertPEM),
+		writeFile(t, dir, "server.key", serverCert.KeyPEM), caFile, 0, onReload)
+	if err != nil {
+		t.Fatalf("bad server source: %v", err)
+	}
+	client, err = NewSource(writeFile(t, dir, "client.crt", clientCert.CertPEM),
+		writeFile(t, dir, "client.key", clientCert.KeyPEM), caFile, 0, nil)
+	if err != nil {
+		t.Fatalf("bad client source: %v", err)
+	}
+	return server, client
+}
+
+func TestSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []Event
+	server, client := newSources(t, dir, ca, func(e Event) {
+		events = append(events, e)
+	})
+	defer server.Close()
+	defer client.Close()
+
+	if err := handshake(server.ServerConfig(true), client.ClientConfig("localhost")); err != nil {
+		t.Fatalf("bad handshake: %v", err)
+	}
+
+	serverCert, _ := ioutil.ReadFile(filepath.Join(dir, "server.crt"))
+	writeFile(t, dir, "server.crt", []byte("invalid"))
+	if err := server.Reload(); err == nil {
+		t.Fatalf("invalid certificate should fail to reload")
+	}
+	if err := handshake(server.ServerConfig(true), client.ClientConfig("localhost")); err != nil {
+		t.Fatalf("previous certificate should still be served: %v", err)
+	}
+
+	writeFile(t, dir, "server.crt", append(serverCert, '\n'))
+	if err := server.Reload(); err != nil {
+		t.Fatalf("bad reload: %v", err)
+	}
+
+	if len(events) != 3 || events[0].Err != nil || events[1].Err == nil || events[2].Err != nil {
+		t.Fatalf("bad reload events: %+v", events)
+	}
+}
+
+func TestSourceVerifyServerName(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, client := newSources(t, dir, ca, nil)
+	defer server.Close()
+	defer client.Close()
+
+	if err := handshake(server.ServerConfig(true), client.ClientConfig("")); err == nil {
+		t.Fatalf("handshake without server name should fail")
+	}
+
+	// gRPC sets the server name of the dial target when the config has none
+	dialed := client.ClientConfig("")
+	dialed.ServerName = "payments.internal"
+	if err := handshake(server.ServerConfig(true), dialed); err == nil {
+		t.Fatalf("certificate of another host should be rejected")
+	}
+	dialed.ServerName = "localhost"
+	if err := handshake(server.ServerConfig(true), dialed); err != nil {
+		t.Fatalf("bad handshake: %v", err)
+	}
+
+	other, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := other.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	strangerCfg := ca.ClientConfig(nil, "localhost")
+	strangerCfg.Certificates = []tls.Certificate{stranger.TLSCertificate()}
+	if err := handshake(server.ServerConfig(true), strangerCfg); err == nil {
+		t.Fatalf("client certificate of another CA should be rejected")
+	}
+}
+
+func TestSourceServerConfigALPN(t *testing.T) {
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, client := newSources(t, t.TempDir(), ca, nil)
+	defer server.Close()
+	defer client.Close()
+
+	serverCfg := server.ServerConfig(true)
+	serverCfg.NextProtos = []string{"h2", "http/1.1"}
+	clientCfg := client.ClientConfig("localhost")
+	clientCfg.NextProtos = []string{"h2"}
+
+	state, err := handshakeState(serverCfg, clientCfg)
+	if err != nil {
+		t.Fatalf("bad handshake: %v", err)
+	}
+	if state.NegotiatedProtocol != "h2" {
+		t.Fatalf("want h2, got %q", state.NegotiatedProtocol)
+	}
+}
+
+func TestSourceMutualRequiresCA(t *testing.T) {
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	_, client := newSources(t, dir, ca, nil)
+	defer client.Close()
+
+	// without CA file client certificates would be verified against the system roots
+	server, err := NewSource(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), "", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	if err := handshake(server.ServerConfig(true), client.ClientConfig("localhost")); err == nil {
+		t.Fatalf("mutual TLS without CA should fail")
+	}
+	if err := handshake(server.ServerConfig(false), client.ClientConfig("localhost")); err != nil {
+		t.Fatalf("bad handshake without mutual TLS: %v", err)
+	}
+}
+
+func TestSecretSource(t *testing.T) {
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := ca.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := ca.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault := secrets.NewFakeVault("")
+	vault.Put("tls/server", map[string]interface{}{
+		"cert": string(serverCert.CertPEM),
+		"key":  string(serverCert.KeyPEM),
+		"ca":   string(ca.CertPEM),
+	})
+	httpServer := httptest.NewServer(vault)
+	defer httpServer.Close()
+	provider := secrets.NewVault(httpServer.URL, "", "", httpServer.Client())
+
+	server, err := NewSecretSource(provider, "tls/server#cert", "tls/server#key", "tls/server#ca", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	dir := t.TempDir()
+	client, err := NewSource(writeFile(t, dir, "client.crt", clientCert.CertPEM),
+		writeFile(t, dir, "client.key", clientCert.KeyPEM), writeFile(t, dir, "ca.crt", ca.CertPEM), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := handshake(server.ServerConfig(true), client.ClientConfig("localhost")); err != nil {
+		t.Fatalf("bad handshake: %v", err)
+	}
+
+	// rotation in Vault is picked up by the next reload
+	rotated, err := ca.Server(tlstest.WithDNSNames("orders.internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.Put("tls/server", map[string]interface{}{
+		"cert": string(rotated.CertPEM),
+		"key":  string(rotated.KeyPEM),
+		"ca":   string(ca.CertPEM),
+	})
+	if err := server.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(server.ServerConfig(true), client.ClientConfig("orders.internal")); err != nil {
+		t.Fatalf("rotated certificate should be served: %v", err)
+	}
+
+	if _, err := NewSecretSource(provider, "tls/server#missing", "tls/server#key", "", 0, nil); err == nil {
+		t.Fatalf("missing secret should fail")
+	}
+}
@@ -3,66 +3,162 @@ package tls
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
+	"log"
 )
 
-func WithCertificate(ca, cert, key []byte, mutual bool) *tls.Config {
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(ca)
+func logWarnings(warnings []string) {
+	for _, w := range warnings {
+		log.Printf("tls warning: %s", w)
+	}
+}
 
-	keyPair, err := tls.X509KeyPair(cert, key)
+// NewCertificate returns TLS config with key pair and optional CA, the CA verifies clients if mutual is true.
+// It fails on invalid PEM, mismatching key, expired certificate, or when mutual and CA is missing or did not
+// issue cert.
+func NewCertificate(ca, cert, key []byte, mutual bool) (*tls.Config, error) {
+	if mutual && len(ca) == 0 {
+		return nil, errors.New("tls: CA is required for mutual TLS")
+	}
+	pool, keyPair, warnings, err := load(ca, cert, key, mutual)
 	if err != nil {
-		return nil
+		return nil, err
+	}
+	if keyPair == nil {
+		return nil, errors.New("tls: certificate and key are required")
 	}
+	logWarnings(warnings)
 
 	tlsCfg := &tls.Config{
-		Certificates: []tls.Certificate{keyPair},
-		RootCAs:      caCertPool,
+		Certificates: []tls.Certificate{*keyPair},
+		RootCAs:      pool,
 		MinVersion:   tls.VersionTLS12,
 	}
 
 	if mutual {
-		tlsCfg.ClientCAs = caCertPool
+		tlsCfg.ClientCAs = pool
 		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
-	return tlsCfg
+	return tlsCfg, nil
 }
 
-func WithCertificatePair(cert, key []byte) *tls.Config {
-	keyPair, err := tls.X509KeyPair(cert, key)
+// NewCertificatePair returns TLS config with key pair, it fails on invalid PEM, mismatching key or expired certificate
+func NewCertificatePair(cert, key []byte) (*tls.Config, error) {
+	keyPair, warnings, err := ParseKeyPair(cert, key)
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	logWarnings(warnings)
 
 	tlsCfg := &tls.Config{
 		Certificates: []tls.Certificate{keyPair},
 		MinVersion:   tls.VersionTLS12,
 	}
 
-	return tlsCfg
+	return tlsCfg, nil
 }
 
-func WithCA(ca []byte) *tls.Config {
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(ca)
+// NewCA returns TLS config trusting CA, it fails on invalid PEM or expired CA
+func NewCA(ca []byte) (*tls.Config, error) {
+	return NewServerAndCA("", ca)
+}
+
+// NewServerAndCA returns TLS config trusting CA for server named serverName, it fails on invalid PEM or expired CA
+func NewServerAndCA(serverName string, ca []byte) (*tls.Config, error) {
+	pool, warnings, err := ParseCA(ca)
+	if err != nil {
+		return nil, err
+	}
+	logWarnings(warnings)
 
 	tlsCfg := &tls.Config{
-		RootCAs:    caCertPool,
+		RootCAs:    pool,
+		ServerName: serverName,
 		MinVersion: tls.VersionTLS12,
 	}
 
+	return tlsCfg, nil
+}
+
+// WithCertificate returns TLS config with key pair and CA, or nil on invalid key pair. Certificate material
+// that NewCertificate rejects, e.g. an expired certificate, is logged and used as is.
+//
+// Deprecated: use NewCertificate, it reports invalid certificate material.
+func WithCertificate(ca, cert, key []byte, mutual bool) *tls.Config {
+	tlsCfg, err := NewCertificate(ca, cert, key, mutual)
+	if err == nil {
+		return tlsCfg
+	}
+	log.Print(err)
+
+	keyPair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil
+	}
+	pool := legacyPool(ca)
+	tlsCfg = &tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if mutual {
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
 	return tlsCfg
 }
 
+// WithCertificatePair returns TLS config with key pair, or nil on invalid key pair. Certificate material
+// that NewCertificatePair rejects, e.g. an expired certificate, is logged and used as is.
+//
+// Deprecated: use NewCertificatePair, it reports invalid certificate material.
+func WithCertificatePair(cert, key []byte) *tls.Config {
+	tlsCfg, err := NewCertificatePair(cert, key)
+	if err == nil {
+		return tlsCfg
+	}
+	log.Print(err)
+
+	keyPair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// WithCA returns TLS config trusting CA, CA that NewCA rejects is logged and used as is.
+//
+// Deprecated: use NewCA, it reports invalid certificate material.
+func WithCA(ca []byte) *tls.Config {
+	return WithServerAndCA("", ca)
+}
+
+// WithServerAndCA returns TLS config trusting CA for server named serverName, CA that NewServerAndCA rejects
+// is logged and used as is.
+//
+// Deprecated: use NewServerAndCA, it reports invalid certificate material.
 func WithServerAndCA(serverName string, ca []byte) *tls.Config {
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(ca)
+	tlsCfg, err := NewServerAndCA(serverName, ca)
+	if err == nil {
+		return tlsCfg
+	}
+	log.Print(err)
 
-	tlsCfg := &tls.Config{
-		RootCAs:    caCertPool,
+	return &tls.Config{
+		RootCAs:    legacyPool(ca),
 		ServerName: serverName,
 		MinVersion: tls.VersionTLS12,
 	}
+}
 
-	return tlsCfg
-}
\ No newline at end of file
+// legacyPool returns pool of the certificates of ca without validation, like the deprecated constructors always did
+func legacyPool(ca []byte) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	return pool
+}
@@ -1,8 +1,20 @@
-package tls_test
+package tls
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/budhip/common/tls/tlstest"
 )
 
 func ca() []byte {
@@ -47,3 +59,106 @@ func TestWithCA(t *testing.T) {
 	}
 }
 
+func TestNewCertificate(t *testing.T) {
+	if _, err := NewCertificate(ca(), cert(), key(), true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := NewCertificate(ca(), cert(), []byte("not a key"), false); !errors.Is(err, ErrInvalidPEM) {
+		t.Fatalf("expected invalid PEM, got %v", err)
+	}
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(otherKey)
+	mismatch := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if _, err := NewCertificate(ca(), cert(), mismatch, false); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected key mismatch, got %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ = x509.CreateCertificate(rand.Reader, template, template, &otherKey.PublicKey, otherKey)
+	otherCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if _, err := NewCertificate(otherCA, cert(), key(), true); !errors.Is(err, ErrUntrusted) {
+		t.Fatalf("expected untrusted, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	year := 365 * 24 * time.Hour
+	ca, err := tlstest.NewCA(tlstest.WithExpiry(year))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ca.Server(tlstest.WithExpiry(year))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warnings, err := Validate(ca.CertPEM, server.CertPEM, server.KeyPEM)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("unexpected result: %v %v", warnings, err)
+	}
+
+	defer func(d time.Duration) { ExpiryWarning = d }(ExpiryWarning)
+	ExpiryWarning = 2 * year
+	if warnings, _ = Validate(ca.CertPEM, server.CertPEM, server.KeyPEM); len(warnings) != 2 {
+		t.Fatalf("expected CA and certificate expiry warnings, got %v", warnings)
+	}
+}
+
+func TestNewCertificateWithoutCA(t *testing.T) {
+	if _, err := NewCertificate(nil, cert(), key(), false); err != nil {
+		t.Fatalf("CA should be optional without mutual TLS: %v", err)
+	}
+	if _, err := NewCertificate(nil, cert(), key(), true); err == nil {
+		t.Fatalf("mutual TLS without CA should fail")
+	}
+}
+
+func TestWithCertificateExpired(t *testing.T) {
+	ca, err := tlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := ca.Server(tlstest.WithExpiry(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewCertificate(ca.CertPEM, expired.CertPEM, expired.KeyPEM, false); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected expired, got %v", err)
+	}
+	if got := WithCertificate(ca.CertPEM, expired.CertPEM, expired.KeyPEM, false); got == nil {
+		t.Fatalf("deprecated constructor should keep accepting expired certificates")
+	}
+	if got := WithCertificate(nil, cert(), []byte("not a key"), false); got != nil {
+		t.Fatalf("invalid key pair should return nil")
+	}
+}
+
+func TestParseCAExpired(t *testing.T) {
+	expired, err := tlstest.NewCA(tlstest.WithExpiry(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, warnings, err := ParseCA(append(append([]byte{}, expired.CertPEM...), ca()...))
+	if err != nil || pool == nil {
+		t.Fatalf("expired CA in bundle should be skipped: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "skipped") {
+		t.Fatalf("expected warning about skipped CA, got %v", warnings)
+	}
+
+	if _, _, err := ParseCA(expired.CertPEM); !errors.Is(err, ErrExpired) {
+		t.Fatalf("bundle without valid CA should fail, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Package tlstest generates certificate authorities and certificates in memory for tests.
+//
+//	serverCfg, clientCfg := tlstest.Configs(t)
+//
+// returns mutual TLS configs for a server at localhost, signed by a fresh CA.
+package tlstest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// KeyAlgorithm is the algorithm of generated keys
+type KeyAlgorithm int
+
+const (
+	// ECDSA generates P-256 keys, the default
+	ECDSA KeyAlgorithm = iota
+	// RSA generates 2048 bit keys
+	RSA
+	// Ed25519 generates Ed25519 keys
+	Ed25519
+)
+
+func (a KeyAlgorithm) String() string {
+	switch a {
+	case ECDSA:
+		return "ECDSA"
+	case RSA:
+		return "RSA"
+	case Ed25519:
+		return "Ed25519"
+	}
+	return fmt.Sprintf("KeyAlgorithm(%d)", int(a))
+}
+
+func (a KeyAlgorithm) generate() (crypto.Signer, error) {
+	switch a {
+	case ECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case RSA:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("tlstest: unknown key algorithm %v", a)
+}
+
+type options struct {
+	algorithm   KeyAlgorithm
+	validFor    time.Duration
+	commonName  string
+	dnsNames    []string
+	ipAddresses []net.IP
+	uris        []*url.URL
+}
+
+// Option configures a generated certificate
+type Option func(*options)
+
+// WithKeyAlgorithm sets the key algorithm, ECDSA by default
+func WithKeyAlgorithm(algorithm KeyAlgorithm) Option {
+	return func(o *options) {
+		o.algorithm = algorithm
+	}
+}
+
+// WithExpiry sets how long the certificate is valid from now, one day by default.
+// A negative duration generates a certificate that is already expired.
+func WithExpiry(validFor time.Duration) Option {
+	return func(o *options) {
+		o.validFor = validFor
+	}
+}
+
+// WithCommonName sets the subject common name
+func WithCommonName(commonName string) Option {
+	return func(o *options) {
+		o.commonName = commonName
+	}
+}
+
+// WithDNSNames sets the DNS name SANs, server certificates default to localhost
+func WithDNSNames(names ...string) Option {
+	return func(o *options) {
+		o.dnsNames = names
+	}
+}
+
+// WithIPAddresses sets the IP address SANs, server certificates default to 127.0.0.1 and ::1
+func WithIPAddresses(ips ...net.IP) Option {
+	return func(o *options) {
+		o.ipAddresses = ips
+	}
+}
+
+// WithURIs sets the URI SANs, e.g. a SPIFFE ID such as spiffe://example.org/ns/default/sa/api
+func WithURIs(uris ...string) Option {
+	return func(o *options) {
+		for _, uri := range uris {
+			u, err := url.Parse(uri)
+			if err != nil {
+				panic(fmt.Sprintf("tlstest: invalid URI %q: %v", uri, err))
+			}
+			o.uris = append(o.uris, u)
+		}
+	}
+}
+
+func newOptions(defaults options, opts []Option) options {
+	o := defaults
+	o.validFor = 24 * time.Hour
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Certificate is a generated certificate with its private key
+type Certificate struct {
+	Cert    *x509.Certificate
+	Key     crypto.Signer
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// TLSCertificate returns the certificate as key pair for tls.Config
+func (c *Certificate) TLSCertificate() tls.Certificate {
+	return tls.Certificate{
+		Certificate: [][]byte{c.Cert.Raw},
+		PrivateKey:  c.Key,
+		Leaf:        c.Cert,
+	}
+}
+
+// CA is a certificate authority issuing server and client certificates
+type CA struct {
+	Certificate
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func create(template *x509.Certificate, parent *Certificate, o options) (*Certificate, error) {
+	key, err := o.algorithm.generate()
+	if err != nil {
+		return nil, err
+	}
+	if template.SerialNumber, err = serialNumber(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template.NotBefore = now.Add(-time.Hour)
+	template.NotAfter = now.Add(o.validFor)
+	if template.NotAfter.Before(template.NotBefore) {
+		template.NotBefore = template.NotAfter.Add(-time.Hour)
+	}
+	template.Subject = pkix.Name{CommonName: o.commonName}
+	template.DNSNames = o.dnsNames
+	template.IPAddresses = o.ipAddresses
+	template.URIs = o.uris
+	template.KeyUsage |= x509.KeyUsageDigitalSignature
+	if o.algorithm == RSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, key.Public(), parentKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certificate{
+		Cert:    cert,
+		Key:     key,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// NewCA returns a self-signed certificate authority
+func NewCA(opts ...Option) (*CA, error) {
+	o := newOptions(options{commonName: "tlstest CA"}, opts)
+	cert, err := create(&x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, nil, o)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Certificate: *cert}, nil
+}
+
+// Pool returns pool trusting the CA
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
+// Server issues server certificate, valid for localhost, 127.0.0.1 and ::1 unless SANs are given
+func (ca *CA) Server(opts ...Option) (*Certificate, error) {
+	o := newOptions(options{
+		commonName:  "localhost",
+		dnsNames:    []string{"localhost"},
+		ipAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}, opts)
+	return create(&x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca.Certificate, o)
+}
+
+// Client issues client certificate for mutual TLS
+func (ca *CA) Client(opts ...Option) (*Certificate, error) {
+	o := newOptions(options{commonName: "client"}, opts)
+	return create(&x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca.Certificate, o)
+}
+
+// ServerConfig returns server config serving server, client certificates issued by the CA are required if mutual
+func (ca *CA) ServerConfig(server *Certificate, mutual bool) *tls.Config {
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{server.TLSCertificate()},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if mutual {
+		cfg.ClientCAs = ca.Pool()
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg
+}
+
+// ClientConfig returns client config verifying serverName against the CA, client may be nil without mutual TLS
+func (ca *CA) ClientConfig(client *Certificate, serverName string) *tls.Config {
+	cfg := &tls.Config{
+		RootCAs:    ca.Pool(),
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if client != nil {
+		cfg.Certificates = []tls.Certificate{client.TLSCertificate()}
+	}
+	return cfg
+}
+
+// Configs returns mutual TLS server and client configs for a server at localhost, opts apply to the server and
+// client certificates, not to the CA. It fails the test when the certificates cannot be generated.
+func Configs(t testing.TB, opts ...Option) (server, client *tls.Config) {
+	t.Helper()
+
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatalf("tlstest: generate CA: %v", err)
+	}
+	serverCert, err := ca.Server(opts...)
+	if err != nil {
+		t.Fatalf("tlstest: generate server certificate: %v", err)
+	}
+	clientCert, err := ca.Client(opts...)
+	if err != nil {
+		t.Fatalf("tlstest: generate client certificate: %v", err)
+	}
+
+	return ca.ServerConfig(serverCert, true), ca.ClientConfig(clientCert, "localhost")
+}
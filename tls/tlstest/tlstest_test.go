@@ -0,0 +1,88 @@
+package tlstest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+)
+
+func handshake(server, client *tls.Config) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		errs <- tls.Server(conn, server).Handshake()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := tls.Client(conn, client).Handshake(); err != nil {
+		return err
+	}
+	return <-errs
+}
+
+func TestConfigs(t *testing.T) {
+	for _, algorithm := range []KeyAlgorithm{ECDSA, RSA, Ed25519} {
+		server, client := Configs(t, WithKeyAlgorithm(algorithm))
+		if err := handshake(server, client); err != nil {
+			t.Fatalf("bad %v handshake: %v", algorithm, err)
+		}
+	}
+
+	server, client := Configs(t, WithCommonName("orders"), WithExpiry(time.Hour))
+	if err := handshake(server, client); err != nil {
+		t.Fatalf("bad handshake: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(client.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "orders" || leaf.Issuer.CommonName != "tlstest CA" {
+		t.Fatalf("options should only apply to the leaves: %v issued by %v", leaf.Subject, leaf.Issuer)
+	}
+}
+
+func TestCA(t *testing.T) {
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ca.Server(WithDNSNames("api.example.org"), WithURIs("spiffe://example.org/api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := ca.Client(WithExpiry(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handshake(ca.ServerConfig(server, false), ca.ClientConfig(nil, "api.example.org")); err != nil {
+		t.Fatalf("bad handshake: %v", err)
+	}
+	if err := handshake(ca.ServerConfig(server, false), ca.ClientConfig(nil, "localhost")); err == nil {
+		t.Fatalf("server name should not match")
+	}
+	if err := handshake(ca.ServerConfig(server, true), ca.ClientConfig(expired, "api.example.org")); err == nil {
+		t.Fatalf("expired client certificate should be rejected")
+	}
+	if got := server.Cert.URIs[0].String(); got != "spiffe://example.org/api" {
+		t.Fatalf("bad URI SAN: %v", got)
+	}
+}
@@ -0,0 +1,227 @@
+package tls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidPEM is returned when certificate or key material is not valid PEM
+	ErrInvalidPEM = errors.New("tls: invalid PEM")
+	// ErrKeyMismatch is returned when the private key does not belong to the certificate
+	ErrKeyMismatch = errors.New("tls: private key does not match certificate")
+	// ErrExpired is returned when a certificate is expired or not valid yet
+	ErrExpired = errors.New("tls: certificate is expired or not yet valid")
+	// ErrUntrusted is returned when a certificate does not chain up to the CA
+	ErrUntrusted = errors.New("tls: certificate is not signed by CA")
+)
+
+// ExpiryWarning is how long before expiry a certificate is reported in warnings
+var ExpiryWarning = 30 * 24 * time.Hour
+
+// parseCertificates parses every CERTIFICATE block of data
+func parseCertificates(data []byte, name string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPEM, name, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%w: %s: no CERTIFICATE block found", ErrInvalidPEM, name)
+	}
+	return certs, nil
+}
+
+// parsePrivateKey parses the first private key block of data
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, fmt.Errorf("%w: key: no PRIVATE KEY block found", ErrInvalidPEM)
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+
+		if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+		if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key: %v", ErrInvalidPEM, err)
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, nil
+		case *ecdsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		}
+		return nil, fmt.Errorf("%w: key: unsupported private key type %T", ErrInvalidPEM, key)
+	}
+}
+
+func checkValidity(cert *x509.Certificate, name string, now time.Time) (warnings []string, err error) {
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, fmt.Errorf("%w: %s %q is valid from %s to %s", ErrExpired, name, cert.Subject.CommonName,
+			cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+	}
+	if cert.NotAfter.Sub(now) < ExpiryWarning {
+		warnings = append(warnings, fmt.Sprintf("%s %q expires at %s", name, cert.Subject.CommonName,
+			cert.NotAfter.Format(time.RFC3339)))
+	}
+	return warnings, nil
+}
+
+// ParseCA returns pool of the valid CA certificates in ca, expired ones are skipped with a warning since bundles
+// often carry them. It fails on invalid PEM or when no valid CA remains.
+func ParseCA(ca []byte) (*x509.CertPool, []string, error) {
+	certs, err := parseCertificates(ca, "CA")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	var lastErr error
+	valid := 0
+	pool := x509.NewCertPool()
+	now := time.Now()
+	for _, cert := range certs {
+		w, err := checkValidity(cert, "CA", now)
+		if err != nil {
+			warnings = append(warnings, "skipped "+strings.TrimPrefix(err.Error(), ErrExpired.Error()+": "))
+			lastErr = err
+			continue
+		}
+		warnings = append(warnings, w...)
+		pool.AddCert(cert)
+		valid++
+	}
+	if valid == 0 {
+		return nil, nil, lastErr
+	}
+	return pool, warnings, nil
+}
+
+// ParseKeyPair returns key pair of cert and key, it fails on invalid PEM, mismatching key or expired certificate
+func ParseKeyPair(cert, key []byte) (tls.Certificate, []string, error) {
+	certs, err := parseCertificates(cert, "certificate")
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	signer, err := parsePrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	certKey, err := x509.MarshalPKIXPublicKey(certs[0].PublicKey)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("%w: certificate: %v", ErrInvalidPEM, err)
+	}
+	privateKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil || !bytes.Equal(certKey, privateKey) {
+		return tls.Certificate{}, nil, fmt.Errorf("%w: certificate %q", ErrKeyMismatch, certs[0].Subject.CommonName)
+	}
+
+	warnings, err := checkValidity(certs[0], "certificate", time.Now())
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	keyPair := tls.Certificate{PrivateKey: signer, Leaf: certs[0]}
+	for _, c := range certs {
+		keyPair.Certificate = append(keyPair.Certificate, c.Raw)
+	}
+	return keyPair, warnings, nil
+}
+
+// VerifyChain checks that key pair chains up to a CA of pool, using the intermediates of the key pair
+func VerifyChain(keyPair tls.Certificate, pool *x509.CertPool) error {
+	if keyPair.Leaf == nil || pool == nil {
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, raw := range keyPair.Certificate[1:] {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("%w: intermediate certificate: %v", ErrInvalidPEM, err)
+		}
+		intermediates.AddCert(cert)
+	}
+
+	_, err := keyPair.Leaf.Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: certificate %q: %v", ErrUntrusted, keyPair.Leaf.Subject.CommonName, err)
+	}
+	return nil
+}
+
+// Validate checks certificate material, ca and cert with key are optional. When both are given the certificate
+// must be issued by ca. It returns warnings for certificates expiring within ExpiryWarning.
+func Validate(ca, cert, key []byte) ([]string, error) {
+	_, _, warnings, err := load(ca, cert, key, true)
+	return warnings, err
+}
+
+// load parses and validates ca and key pair, both are optional
+func load(ca, cert, key []byte, verifyChain bool) (*x509.CertPool, *tls.Certificate, []string, error) {
+	var warnings []string
+	var pool *x509.CertPool
+	if len(ca) > 0 {
+		p, w, err := ParseCA(ca)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pool = p
+		warnings = append(warnings, w...)
+	}
+
+	var keyPair *tls.Certificate
+	if len(cert) > 0 || len(key) > 0 {
+		kp, w, err := ParseKeyPair(cert, key)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		keyPair = &kp
+		warnings = append(warnings, w...)
+		if verifyChain {
+			if err := VerifyChain(kp, pool); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	return pool, keyPair, warnings, nil
+}